@@ -0,0 +1,342 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrBufferFull is returned by the batching writers if a log message
+// cannot be buffered without exceeding the configured memory bound.
+// The log message is dropped.
+var ErrBufferFull = errors.New("log: buffer full, message dropped")
+
+// BatchError is reported to the error handler registered with
+// OnError if a batch of log messages cannot be delivered.
+type BatchError struct {
+	// Lines are the formatted log messages of the batch.
+	Lines [][]byte
+
+	// Err is the error that occurred.
+	Err error
+}
+
+// Error returns the error message of the underlying error.
+func (e *BatchError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// BatchConfig configures how the batching writers buffer
+// the log messages, send them in batches and retry the
+// batches that cannot be delivered. It is embedded in the
+// configs of the writers.
+type BatchConfig struct {
+	// BatchCount is the maximum number of log messages
+	// in a batch. If zero, the default of the writer
+	// will be used.
+	BatchCount int
+
+	// BatchBytes is the maximum size of a batch in bytes.
+	// If zero, the default of the writer will be used.
+	BatchBytes int
+
+	// FlushInterval is the maximum time a log message is
+	// buffered before it is sent. If zero, 1 second will be used.
+	FlushInterval time.Duration
+
+	// MaxBufferBytes is the maximum size of the buffered log
+	// messages in bytes. Log messages that would exceed it are
+	// dropped and ErrBufferFull is returned. If zero, 50 MB
+	// will be used.
+	MaxBufferBytes int
+
+	// MaxRetries is the maximum number of retries of a batch
+	// that cannot be delivered because the receiver is
+	// unavailable or overloaded. If zero, 3 will be used,
+	// a negative value disables retrying.
+	MaxRetries int
+
+	// RetryBackoff is the base delay between retries, it is
+	// doubled with every retry and jittered. A delay requested
+	// by an HTTP server in the Retry-After header takes
+	// precedence. If zero, 100 milliseconds will be used.
+	RetryBackoff time.Duration
+}
+
+// withDefaults returns a copy of the config in which the zero
+// values are replaced with the defaults, count and size are the
+// default batch limits of the writer.
+func (c BatchConfig) withDefaults(count, size int) BatchConfig {
+	if c.BatchCount == 0 {
+		c.BatchCount = count
+	}
+	if c.BatchBytes == 0 {
+		c.BatchBytes = size
+	}
+	if c.FlushInterval == 0 {
+		c.FlushInterval = time.Second
+	}
+	if c.MaxBufferBytes == 0 {
+		c.MaxBufferBytes = 50 << 20
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 3
+	}
+	if c.RetryBackoff == 0 {
+		c.RetryBackoff = 100 * time.Millisecond
+	}
+	return c
+}
+
+// batcher buffers log messages and sends them in batches from a
+// background goroutine. A batch is sent when it reaches the count
+// or size limit, or when the flush interval elapses.
+type batcher struct {
+	config BatchConfig
+	send   func(lines [][]byte) error
+
+	mu       sync.Mutex
+	lines    [][]byte
+	buffered int
+	closed   bool
+	report   func(err error)
+
+	sendMu sync.Mutex
+	flushc chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newBatcher(config BatchConfig, send func(lines [][]byte) error) *batcher {
+	b := &batcher{
+		config: config,
+		send:   send,
+		flushc: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.loop()
+	return b
+}
+
+// Write buffers a log message, the trailing newline is removed.
+func (b *batcher) Write(p []byte) (int, error) {
+	line := make([]byte, len(p))
+	copy(line, p)
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return 0, errors.New("log: write to closed writer")
+	}
+	if b.config.MaxBufferBytes > 0 && b.buffered+len(line) > b.config.MaxBufferBytes {
+		return 0, ErrBufferFull
+	}
+	b.lines = append(b.lines, line)
+	b.buffered += len(line)
+
+	if len(b.lines) >= b.config.BatchCount || b.buffered >= b.config.BatchBytes {
+		select {
+		case b.flushc <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends the buffered log messages and returns
+// the first error that occurred.
+func (b *batcher) Flush() error {
+	return b.flush(false)
+}
+
+// Close flushes the buffered log messages and stops
+// the background goroutine.
+func (b *batcher) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	close(b.done)
+	b.wg.Wait()
+	return b.flush(false)
+}
+
+func (b *batcher) notifyErrors(f func(err error)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.report = f
+}
+
+func (b *batcher) loop() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.flushc:
+		case <-b.done:
+			return
+		}
+		b.flush(true)
+	}
+}
+
+// flush sends the buffered log messages batch by batch.
+// If async is true errors are reported to the router.
+func (b *batcher) flush(async bool) error {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+
+	var firstErr error
+	for {
+		lines := b.next()
+		if len(lines) == 0 {
+			return firstErr
+		}
+
+		err := b.send(lines)
+
+		b.mu.Lock()
+		for _, line := range lines {
+			b.buffered -= len(line)
+		}
+		report := b.report
+		b.mu.Unlock()
+
+		if err != nil {
+			err = &BatchError{lines, err}
+			if firstErr == nil {
+				firstErr = err
+			}
+			if async && report != nil {
+				report(err)
+			}
+		}
+	}
+}
+
+// next returns the next batch. The lines stay accounted
+// in the buffered size until the batch is sent.
+func (b *batcher) next() [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, size := 0, 0
+	for n < len(b.lines) && n < b.config.BatchCount {
+		if n > 0 && size+len(b.lines[n]) > b.config.BatchBytes {
+			break
+		}
+		size += len(b.lines[n])
+		n++
+	}
+
+	lines := b.lines[:n:n]
+	b.lines = b.lines[n:]
+	return lines
+}
+
+// backoff returns the delay before the given retry attempt,
+// exponential with full jitter.
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base << uint(attempt)
+	if d <= 0 || d > time.Minute {
+		d = time.Minute
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// post sends the request created by newRequest. Requests that
+// fail with a network error or with status 429 or 5xx are
+// retried at most MaxRetries times, after the delay requested
+// in the Retry-After header or with exponential backoff.
+func post(client *http.Client, c BatchConfig, newRequest func() (*http.Request, error)) error {
+	var err error
+	var wait time.Duration
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if attempt > c.MaxRetries {
+				return fmt.Errorf("%v (gave up after %d attempts)", err, attempt)
+			}
+			if wait <= 0 {
+				wait = backoff(c.RetryBackoff, attempt-1)
+			}
+			time.Sleep(wait)
+		}
+
+		var req *http.Request
+		req, err = newRequest()
+		if err != nil {
+			return err
+		}
+
+		var resp *http.Response
+		resp, err = client.Do(req)
+		wait = 0
+		if err != nil {
+			continue
+		}
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		err = fmt.Errorf("log: %s: %s: %s", req.URL, resp.Status, bytes.TrimSpace(b))
+		if !retryable(resp.StatusCode) {
+			return err
+		}
+		wait = retryAfter(resp.Header.Get("Retry-After"))
+	}
+}
+
+// retryAfter returns the delay requested in a Retry-After
+// header, in seconds or as an HTTP date. At most a minute
+// is honored.
+func retryAfter(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+
+	var d time.Duration
+	if s, err := strconv.Atoi(h); err == nil {
+		d = time.Duration(s) * time.Second
+	} else if t, err := http.ParseTime(h); err == nil {
+		d = time.Until(t)
+	}
+	if d > time.Minute {
+		d = time.Minute
+	}
+	return d
+}
+
+// retryable reports whether a request that failed with
+// the given HTTP status code should be retried.
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status/100 == 5
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"errors"
+)
+
+// FieldDeadLetter is the name of the field that holds the
+// details of a failed delivery in the log messages written
+// to the dead-letter output.
+const FieldDeadLetter = "dead_letter"
+
+// Stages of the delivery of a log message to an output,
+// as they appear in the log messages written to the
+// dead-letter output.
+const (
+	StageFilter  = "filter"
+	StageProcess = "process"
+	StageFormat  = "format"
+	StageWrite   = "write"
+	StageHook    = "hook"
+)
+
+// DeadLetter registers the dead-letter output in the DefaultRouter.
+// A nil Writer removes the dead-letter output.
+//
+// Whenever a log message cannot be delivered to another output,
+// because its filter, processors, formatter or writer fails, a
+// copy of the log message is written to the dead-letter output
+// with the details of the failure at the key FieldDeadLetter:
+//
+//	{
+//	    "output": "<the Id of the failed output>",
+//	    "stage":  "filter" | "process" | "format" | "write" | "hook",
+//	    "error":  "<the error message>"
+//	}
+//
+// Writers that write log messages asynchronously in batches
+// report their errors without the original log message. If
+// the error is a *BatchError the formatted log messages of the
+// batch are added to the details at the key "lines".
+//
+// The dead-letter output does not receive any other log
+// messages. Errors of the dead-letter output itself are only
+// reported to the error handler registered with OnError.
+func DeadLetter(o Output) {
+	DefaultRouter.deadLetterOutput(&o)
+}
+
+func (l *defaultRouter) deadLetterOutput(o *Output) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if o.Writer == nil {
+		l.deadLetter = nil
+		return
+	}
+	if o.Formatter == nil {
+		o.Formatter = DefaultFormatter
+	}
+	l.deadLetter = o
+	l.notifyErrors(o)
+}
+
+// writeDeadLetter writes a copy of the fields with the
+// details of the failed delivery to the dead-letter output.
+func (l *defaultRouter) writeDeadLetter(err error, fields Fields, o *Output, stage string) {
+	details := Fields{
+		"output": o.Id,
+		"stage":  stage,
+		"error":  err.Error(),
+	}
+	var batchErr *BatchError
+	if fields == nil && errors.As(err, &batchErr) {
+		lines := make([]string, len(batchErr.Lines))
+		for i, line := range batchErr.Lines {
+			lines[i] = string(line)
+		}
+		details["lines"] = lines
+	}
+
+	dead := make(Fields, len(fields)+1)
+	for k, v := range fields {
+		dead[k] = v
+	}
+	dead[FieldDeadLetter] = details
+
+	_, _, err = l.write(l.deadLetter, dead)
+	if err != nil && l.errorHandler != nil {
+		l.errorHandler(err, dead, *l.deadLetter)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/szxp/log"
+	"testing"
+)
+
+type failingFilter struct{}
+
+func (f failingFilter) Match(fields log.Fields) (bool, error) {
+	return false, errors.New("filter failed")
+}
+
+type failingFormatter struct{}
+
+func (f failingFormatter) Format(fields log.Fields) ([]byte, error) {
+	return nil, errors.New("format failed")
+}
+
+type failingWriter struct{}
+
+func (w failingWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestDeadLetter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log.DeadLetter(log.Output{
+		Writer: buf,
+		Filter: log.FieldExist("deadLetterTest"),
+	})
+	defer log.DeadLetter(log.Output{})
+
+	tests := []struct {
+		output   log.Output
+		expected string
+	}{
+		{
+			log.Output{Id: "deadLetterFilter", Writer: &bytes.Buffer{}, Filter: log.And(log.FieldExist("deadLetterTest"), failingFilter{})},
+			`{"deadLetterTest":1,"dead_letter":{"error":"filter failed","output":"deadLetterFilter","stage":"filter"}}` + "\n",
+		},
+		{
+			log.Output{Id: "deadLetterFormat", Writer: &bytes.Buffer{}, Formatter: failingFormatter{}, Filter: log.FieldExist("deadLetterTest")},
+			`{"deadLetterTest":1,"dead_letter":{"error":"format failed","output":"deadLetterFormat","stage":"format"}}` + "\n",
+		},
+		{
+			log.Output{Id: "deadLetterWrite", Writer: failingWriter{}, Filter: log.FieldExist("deadLetterTest")},
+			`{"deadLetterTest":1,"dead_letter":{"error":"write failed","output":"deadLetterWrite","stage":"write"}}` + "\n",
+		},
+	}
+
+	logger := log.LoggerConfig{SortFields: true}.NewLogger()
+	for _, test := range tests {
+		buf.Reset()
+		test.output.Register()
+		logger.Log(log.Fields{"deadLetterTest": 1})
+		log.Output{Id: test.output.Id}.Register()
+
+		if buf.String() != test.expected {
+			t.Fatalf("expected %q, but got %q", test.expected, buf.String())
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// FieldRepeatCount is the name of the field that holds the
+// number of suppressed repeats of a log message.
+const FieldRepeatCount = "repeat_count"
+
+// DedupeConfig configures the suppression of
+// duplicate log messages in the DefaultRouter.
+type DedupeConfig struct {
+	// Paths are the dot-separated paths of the fields that
+	// identify duplicate log messages. If empty, all fields
+	// except FieldTime, FieldFile and the fields that begin
+	// with underscore will be used. Lazy values are not
+	// evaluated, they are all considered equal.
+	Paths []string
+
+	// Window is the time after the first occurrence of a log
+	// message in which its repeats are suppressed. If zero,
+	// duplicate log messages are not suppressed.
+	Window time.Duration
+}
+
+// Dedupe configures the suppression of duplicate log
+// messages in the DefaultRouter.
+//
+// The first occurrence of a log message is written to the
+// outputs, the repeats within the Window are suppressed. When
+// the Window closes the last repeat is written with the number
+// of suppressed repeats at the key FieldRepeatCount, if there
+// were any.
+func Dedupe(c DedupeConfig) {
+	DefaultRouter.dedupeConfig(c)
+}
+
+func (l *defaultRouter) dedupeConfig(c DedupeConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if c.Window <= 0 {
+		l.dedupe = nil
+		return
+	}
+	d := &dedupe{
+		window:  c.Window,
+		entries: make(map[string]*dedupeEntry),
+	}
+	for _, path := range c.Paths {
+		d.paths = append(d.paths, SplitPath(path))
+	}
+	l.dedupe = d
+}
+
+// dedupe holds the log messages seen in their windows.
+// It is guarded by the lock of the router.
+type dedupe struct {
+	window  time.Duration
+	paths   [][]string
+	entries map[string]*dedupeEntry
+}
+
+type dedupeEntry struct {
+	last  Fields
+	count int
+}
+
+// repeated reports whether the fields are a repeat of a log
+// message seen in the window. The first occurrence opens the
+// window, the repeats are written when it closes.
+func (d *dedupe) repeated(l *defaultRouter, fields Fields) bool {
+	key := d.fingerprint(fields)
+	e, ok := d.entries[key]
+	if ok {
+		e.last = fields
+		e.count++
+		return true
+	}
+
+	e = &dedupeEntry{}
+	d.entries[key] = e
+	time.AfterFunc(d.window, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		delete(d.entries, key)
+		if e.count == 0 {
+			return
+		}
+		last := make(Fields, len(e.last)+1)
+		for k, v := range e.last {
+			last[k] = v
+		}
+		last[FieldRepeatCount] = e.count
+		l.route(last)
+	})
+	return false
+}
+
+// fingerprint returns the identity of a log message. The values
+// are resolved, so that equal errors have the same fingerprint,
+// rather than being identified by their pointers. Lazy values
+// are not evaluated, they are all identified by a placeholder.
+func (d *dedupe) fingerprint(fields Fields) string {
+	if len(d.paths) > 0 {
+		buf := &strings.Builder{}
+		for _, path := range d.paths {
+			v, ok := fields.Value(path)
+			fmt.Fprintf(buf, "%t%#v\x00", ok, resolveAll(v))
+		}
+		return buf.String()
+	}
+
+	m := make(Fields, len(fields))
+	for k, v := range fields {
+		if k != FieldTime && k != FieldFile && len(k) > 0 && k[0] != '_' {
+			m[k] = v
+		}
+	}
+	// maps are printed with sorted keys
+	return fmt.Sprintf("%#v", resolveAll(m))
+}
+
+// lazyFingerprint is the placeholder of the lazy values.
+type lazyFingerprint struct{}
+
+// resolveAll returns v and its nested values resolved, see
+// resolve. Lazy values are replaced with a placeholder.
+func resolveAll(v interface{}) interface{} {
+	v, _ = resolveFingerprint(v, nil)
+	return transform(v, nil, resolveFingerprint)
+}
+
+// resolveFingerprint resolves v without evaluating lazy values,
+// the elements of containers are left to transform.
+func resolveFingerprint(v interface{}, path []string) (interface{}, bool) {
+	switch v.(type) {
+	case *LazyValue:
+		return lazyFingerprint{}, false
+	case ErrorMarshaler, FieldsMarshaler, json.Marshaler, error:
+		return resolve(v), true
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v, true
+	}
+	return resolve(v), true
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"errors"
+	"github.com/szxp/log"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDedupe(t *testing.T) {
+	log.Dedupe(log.DedupeConfig{Window: 50 * time.Millisecond})
+	defer log.Dedupe(log.DedupeConfig{})
+
+	w := &flakyWriter{}
+	log.Output{Id: "dedupeTest", Writer: w, Filter: log.FieldExist("dedupeTest")}.Register()
+	defer log.Output{Id: "dedupeTest"}.Register()
+
+	logger := log.LoggerConfig{
+		TimeFormat: time.RFC3339Nano,
+		FileLine:   log.ShortFileLine,
+		SortFields: true,
+	}.NewLogger()
+	for i := 0; i < 5; i++ {
+		logger.Log(log.Fields{"dedupeTest": true, "msg": "retrying"})
+	}
+	logger.Log(log.Fields{"dedupeTest": true, "msg": "failed"})
+
+	lines := w.wait(t, 3)
+	tests := []struct {
+		prefix   string
+		contains string
+	}{
+		{`{"dedupeTest":true,"file":"dedupe_test.go:`, `","msg":"retrying","time":"`},
+		{`{"dedupeTest":true,"file":"dedupe_test.go:`, `","msg":"failed","time":"`},
+		{`{"dedupeTest":true,"file":"dedupe_test.go:`, `","msg":"retrying","repeat_count":4,"time":"`},
+	}
+	for i, test := range tests {
+		line := lines[i]
+		if !strings.HasPrefix(line, test.prefix) {
+			t.Fatalf("expected prefix %q, but got %q", test.prefix, line)
+		}
+		if !strings.Contains(line, test.contains) {
+			t.Fatalf("expected %q in %q", test.contains, line)
+		}
+	}
+
+	// a new window
+	logger.Log(log.Fields{"dedupeTest": true, "msg": "retrying"})
+	if lines = w.wait(t, 4); len(lines) != 4 {
+		t.Fatalf("expected 4 lines, but got: %q", lines)
+	}
+}
+
+func TestDedupeErrors(t *testing.T) {
+	log.Dedupe(log.DedupeConfig{Window: 50 * time.Millisecond})
+	defer log.Dedupe(log.DedupeConfig{})
+
+	w := &flakyWriter{}
+	log.Output{Id: "dedupeErrorsTest", Writer: w, Filter: log.FieldExist("dedupeErrorsTest")}.Register()
+	defer log.Output{Id: "dedupeErrorsTest"}.Register()
+
+	logger := log.LoggerConfig{SortFields: true}.NewLogger()
+	for i := 0; i < 3; i++ {
+		// new error and lazy values every time
+		logger.Log(log.Fields{
+			"dedupeErrorsTest": true,
+			"err":              errors.New("connection refused"),
+			"attempts":         log.Lazy(func() interface{} { return 3 }),
+		})
+	}
+
+	lines := w.wait(t, 2)
+	expected := []string{
+		`{"attempts":3,"dedupeErrorsTest":true,"err":"connection refused"}` + "\n",
+		`{"attempts":3,"dedupeErrorsTest":true,"err":"connection refused","repeat_count":2}` + "\n",
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Fatalf("expected %q, but got %q", expected[i], lines[i])
+		}
+	}
+}
+
+func TestDedupeLazy(t *testing.T) {
+	log.Dedupe(log.DedupeConfig{Window: 50 * time.Millisecond})
+	defer log.Dedupe(log.DedupeConfig{})
+
+	w := &flakyWriter{}
+	log.Output{Id: "dedupeLazyTest", Writer: w, Filter: log.Eq("dedupeLazyTest", "write")}.Register()
+	defer log.Output{Id: "dedupeLazyTest"}.Register()
+
+	var calls int32
+	payload := func() interface{} {
+		atomic.AddInt32(&calls, 1)
+		return 1
+	}
+
+	logger := log.LoggerConfig{SortFields: true}.NewLogger()
+	for _, v := range []string{"skip", "skip", "write", "write"} {
+		logger.Log(log.Fields{"dedupeLazyTest": v, "payload": log.Lazy(payload)})
+	}
+
+	lines := w.wait(t, 2)
+	expected := []string{
+		`{"dedupeLazyTest":"write","payload":1}` + "\n",
+		`{"dedupeLazyTest":"write","payload":1,"repeat_count":1}` + "\n",
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Fatalf("expected %q, but got %q", expected[i], lines[i])
+		}
+	}
+
+	// only the written lazy values are evaluated
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("expected 2 calls, but got: %d", n)
+	}
+}
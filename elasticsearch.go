@@ -0,0 +1,269 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ElasticsearchFormatter converts a log message into an
+// index action of the Elasticsearch bulk API: an action
+// line followed by the document line.
+//
+// The document is written to a date-based index, the date
+// is taken from the value at the key FieldTime in UTC.
+//
+// ElasticsearchFormatter is safe for concurrent use by multiple
+// goroutines if the Formatter associated with it is safe for
+// concurrent use by multiple goroutines.
+type ElasticsearchFormatter struct {
+	// Index is the prefix of the index name.
+	// If empty, "logs" will be used.
+	Index string
+
+	// DateFormat is the format of the date appended to the
+	// prefix of the index name. If empty, "2006.01.02" will be
+	// used, that results in index names like "logs-2017.03.04".
+	DateFormat string
+
+	// Formatter converts the log message into the JSON
+	// document. If nil, the DefaultFormatter will be used.
+	Formatter Formatter
+}
+
+// Format returns the fields as a bulk API index action.
+func (f *ElasticsearchFormatter) Format(fields Fields) ([]byte, error) {
+	index := f.Index
+	if index == "" {
+		index = "logs"
+	}
+	dateFormat := f.DateFormat
+	if dateFormat == "" {
+		dateFormat = "2006.01.02"
+	}
+	formatter := f.Formatter
+	if formatter == nil {
+		formatter = DefaultFormatter
+	}
+
+	doc, err := formatter.Format(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	action := map[string]map[string]string{
+		"index": {"_index": index + "-" + timestamp(fields).UTC().Format(dateFormat)},
+	}
+	b, err := json.Marshal(action)
+	if err != nil {
+		return nil, err
+	}
+
+	b = append(b, '\n')
+	return append(b, doc...), nil
+}
+
+// ElasticsearchConfig can be used to create a new ElasticsearchWriter.
+type ElasticsearchConfig struct {
+	// URL of the Elasticsearch or OpenSearch cluster,
+	// e.g. "http://localhost:9200".
+	URL string
+
+	// Username and Password, if non empty, are sent
+	// using HTTP basic authentication.
+	Username string
+	Password string
+
+	// Client sends the HTTP requests. If nil,
+	// http.DefaultClient will be used.
+	Client *http.Client
+
+	// BatchConfig configures the batching and the retries.
+	// If zero, BatchCount is 500 and BatchBytes is 5 MB.
+	// The documents of a batch rejected temporarily are
+	// retried as well.
+	BatchConfig
+}
+
+// NewWriter creates and returns a new ElasticsearchWriter.
+func (c ElasticsearchConfig) NewWriter() *ElasticsearchWriter {
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	c.BatchConfig = c.BatchConfig.withDefaults(500, 5<<20)
+
+	w := &ElasticsearchWriter{config: c}
+	w.batcher = newBatcher(c.BatchConfig, w.send)
+	return w
+}
+
+// ElasticsearchWriter writes log messages formatted by the
+// ElasticsearchFormatter to the bulk API of Elasticsearch
+// or OpenSearch in batches.
+//
+// Batches are sent from a background goroutine. Errors that
+// occur while sending are reported to the error handler
+// registered with OnError. Batches that fail because the
+// cluster is unavailable and documents rejected with status
+// 429 or 5xx are retried after the delay requested in the
+// Retry-After header or with exponential backoff.
+//
+// ElasticsearchWriter is safe for concurrent use by multiple goroutines.
+type ElasticsearchWriter struct {
+	config  ElasticsearchConfig
+	batcher *batcher
+}
+
+// Write buffers the log message.
+func (w *ElasticsearchWriter) Write(b []byte) (int, error) {
+	return w.batcher.Write(b)
+}
+
+// Flush sends the buffered log messages.
+func (w *ElasticsearchWriter) Flush() error {
+	return w.batcher.Flush()
+}
+
+// Close flushes the buffered log messages and
+// stops the background goroutine.
+func (w *ElasticsearchWriter) Close() error {
+	return w.batcher.Close()
+}
+
+func (w *ElasticsearchWriter) notifyErrors(f func(err error)) {
+	w.batcher.notifyErrors(f)
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+func (w *ElasticsearchWriter) send(lines [][]byte) error {
+	var rejected, err error
+	var wait time.Duration
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if attempt > w.config.MaxRetries {
+				return fmt.Errorf("log: elasticsearch: %d documents dropped after %d attempts: %v",
+					len(lines), attempt, err)
+			}
+			if wait <= 0 {
+				wait = backoff(w.config.RetryBackoff, attempt-1)
+			}
+			time.Sleep(wait)
+		}
+
+		var res bulkResult
+		res, err = w.bulk(lines)
+		wait = res.wait
+		if rejected == nil {
+			rejected = res.rejected
+		}
+		if len(res.retry) == 0 {
+			if err != nil {
+				return err
+			}
+			return rejected
+		}
+		lines = res.retry
+	}
+}
+
+// bulkResult is the outcome of a bulk request.
+type bulkResult struct {
+	// retry is the lines that should be retried.
+	retry [][]byte
+
+	// wait is the delay requested by the cluster before the retry.
+	wait time.Duration
+
+	// rejected describes the documents that were rejected
+	// permanently, they are not retried.
+	rejected error
+}
+
+// bulk sends the lines in a bulk request. The error is the
+// error of the request or of the documents to be retried.
+func (w *ElasticsearchWriter) bulk(lines [][]byte) (bulkResult, error) {
+	body := bytes.Join(lines, []byte{'\n'})
+	body = append(body, '\n')
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(w.config.URL, "/")+"/_bulk", bytes.NewReader(body))
+	if err != nil {
+		return bulkResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if w.config.Username != "" || w.config.Password != "" {
+		req.SetBasicAuth(w.config.Username, w.config.Password)
+	}
+
+	resp, err := w.config.Client.Do(req)
+	if err != nil {
+		return bulkResult{retry: lines}, err
+	}
+	defer resp.Body.Close()
+
+	wait := retryAfter(resp.Header.Get("Retry-After"))
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return bulkResult{retry: lines, wait: wait}, err
+	}
+	if retryable(resp.StatusCode) {
+		return bulkResult{retry: lines, wait: wait}, fmt.Errorf("log: elasticsearch: %s", resp.Status)
+	}
+	if resp.StatusCode/100 != 2 {
+		return bulkResult{}, fmt.Errorf("log: elasticsearch: %s: %s", resp.Status, b)
+	}
+
+	r := &bulkResponse{}
+	err = json.Unmarshal(b, r)
+	if err != nil {
+		return bulkResult{}, err
+	}
+	if !r.Errors {
+		return bulkResult{}, nil
+	}
+	if len(r.Items) != len(lines) {
+		// the failed documents cannot be identified
+		return bulkResult{}, fmt.Errorf("log: elasticsearch: bulk request failed with %d items for %d documents",
+			len(r.Items), len(lines))
+	}
+
+	res := bulkResult{wait: wait}
+	count := 0
+	for i, item := range r.Items {
+		for _, result := range item {
+			if result.Status/100 == 2 {
+				continue
+			}
+			if retryable(result.Status) {
+				res.retry = append(res.retry, lines[i])
+				err = fmt.Errorf("log: elasticsearch: %s: %s", result.Error.Type, result.Error.Reason)
+				continue
+			}
+			if res.rejected == nil {
+				res.rejected = fmt.Errorf("%d %s: %s", result.Status, result.Error.Type, result.Error.Reason)
+			}
+			count++
+		}
+	}
+	if res.rejected != nil {
+		res.rejected = fmt.Errorf("log: elasticsearch: %d of %d documents rejected, first: %v", count, len(lines), res.rejected)
+	}
+	return res, err
+}
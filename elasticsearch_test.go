@@ -0,0 +1,171 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"bytes"
+	"github.com/szxp/log"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestElasticsearchFormatter(t *testing.T) {
+	t.Parallel()
+
+	f := &log.ElasticsearchFormatter{Index: "app"}
+	b, err := f.Format(log.Fields{"time": "2017-03-04T23:20:30-02:00", "msg": "hello", "_sort": true})
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+
+	expected := `{"index":{"_index":"app-2017.03.05"}}` + "\n" + `{"msg":"hello","time":"2017-03-04T23:20:30-02:00"}`
+	if string(b) != expected {
+		t.Fatalf("expected %q, but got: %q", expected, string(b))
+	}
+}
+
+func TestElasticsearchWriter(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, string(b))
+
+		switch len(bodies) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			// the second document is rejected temporarily,
+			// the third one permanently
+			io.WriteString(w, `{"errors":true,"items":[`+
+				`{"index":{"status":201}},`+
+				`{"index":{"status":429,"error":{"type":"es_rejected_execution_exception","reason":"busy"}}},`+
+				`{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"bad"}}}]}`)
+		default:
+			io.WriteString(w, `{"errors":false,"items":[{"index":{"status":201}}]}`)
+		}
+	}))
+	defer server.Close()
+
+	w := log.ElasticsearchConfig{
+		URL: server.URL,
+		BatchConfig: log.BatchConfig{
+			BatchCount:    3,
+			FlushInterval: time.Hour,
+			RetryBackoff:  time.Millisecond,
+		},
+	}.NewWriter()
+	defer w.Close()
+
+	lines := []string{"{\"index\":{}}\n{\"n\":1}", "{\"index\":{}}\n{\"n\":2}", "{\"index\":{}}\n{\"n\":3}"}
+	for _, line := range lines {
+		if _, err := w.Write([]byte(line + "\n")); err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+	}
+
+	err := w.Flush()
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 documents rejected") {
+		t.Fatalf("expected rejected documents error, but got: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	all := strings.Join(lines, "\n") + "\n"
+	expected := []string{all, all, lines[1] + "\n"}
+	if len(bodies) != len(expected) {
+		t.Fatalf("expected %d requests, but got %d", len(expected), len(bodies))
+	}
+	for i := range expected {
+		if bodies[i] != expected[i] {
+			t.Fatalf("request %d: expected %q, but got %q", i, expected[i], bodies[i])
+		}
+	}
+}
+
+func TestElasticsearchWriterRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+
+		switch requests {
+		case 1:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			// the items do not match the documents
+			io.WriteString(w, `{"errors":true,"items":[{"index":{"status":201}}]}`)
+		}
+	}))
+	defer server.Close()
+
+	w := log.ElasticsearchConfig{
+		URL: server.URL,
+		BatchConfig: log.BatchConfig{
+			FlushInterval: time.Hour,
+			RetryBackoff:  time.Millisecond,
+		},
+	}.NewWriter()
+	defer w.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := w.Write([]byte("{\"index\":{}}\n{}\n")); err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+	}
+
+	start := time.Now()
+	err := w.Flush()
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("expected a retry after 1s, but got %v", elapsed)
+	}
+
+	batchErr, ok := err.(*log.BatchError)
+	if !ok {
+		t.Fatalf("expected a *log.BatchError, but got %T: %v", err, err)
+	}
+	if len(batchErr.Lines) != 2 {
+		t.Fatalf("expected 2 lines, but got %d", len(batchErr.Lines))
+	}
+}
+
+func TestElasticsearchWriterBufferFull(t *testing.T) {
+	t.Parallel()
+
+	w := log.ElasticsearchConfig{
+		URL: "http://127.0.0.1:0",
+		BatchConfig: log.BatchConfig{
+			FlushInterval:  time.Hour,
+			MaxBufferBytes: 10,
+			MaxRetries:     -1,
+		},
+	}.NewWriter()
+	defer w.Close()
+
+	_, err := w.Write(bytes.Repeat([]byte("x"), 8))
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	_, err = w.Write(bytes.Repeat([]byte("x"), 8))
+	if err != log.ErrBufferFull {
+		t.Fatalf("expected %v, but got %v", log.ErrBufferFull, err)
+	}
+}
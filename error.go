@@ -0,0 +1,175 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+// ErrorMarshaler is implemented by error types
+// that control their representation in log messages.
+//
+// Errors that do not implement ErrorMarshaler or json.Marshaler
+// are represented by their message, or if they wrap other errors
+// or expose a stack trace by a Fields object:
+//
+//	{
+//	    "message": "<the error message>",
+//	    "causes": [<the wrapped errors, represented the same way>],
+//	    "stack": [{"func": "...", "file": "...", "line": 42}, ...]
+//	}
+//
+// Wrapped errors are found with the Unwrap() error and the Unwrap()
+// []error methods, see errors.Unwrap and errors.Join. Stack traces
+// are exposed with a Callers() []uintptr method, or a StackTrace()
+// method returning a slice of program counters, such as the
+// errors of github.com/pkg/errors.
+type ErrorMarshaler interface {
+	// MarshalLogError returns the representation of the error.
+	MarshalLogError() Fields
+}
+
+// errorValue returns the representation of an
+// error value in a log message, see ErrorMarshaler.
+// A nil pointer error is represented by nil.
+func errorValue(err error) interface{} {
+	if isNilPointer(err) {
+		return nil
+	}
+	if m, ok := err.(ErrorMarshaler); ok {
+		return m.MarshalLogError()
+	}
+
+	var causes []interface{}
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		for _, cause := range e.Unwrap() {
+			if cause != nil {
+				causes = append(causes, errorValue(cause))
+			}
+		}
+	default:
+		if cause := errors.Unwrap(err); cause != nil {
+			causes = append(causes, errorValue(cause))
+		}
+	}
+	stack := errorStack(err)
+
+	if causes == nil && stack == nil {
+		return err.Error()
+	}
+	// sorted, the causes may not inherit the option
+	f := Fields{"message": err.Error(), FieldSort: true}
+	if causes != nil {
+		f["causes"] = causes
+	}
+	if stack != nil {
+		f["stack"] = stack
+	}
+	return f
+}
+
+// errorStack returns the stack trace exposed by the error, or nil.
+func errorStack(err error) []Fields {
+	if e, ok := err.(interface{ Callers() []uintptr }); ok {
+		return stackFrames(e.Callers())
+	}
+
+	m := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return nil
+	}
+	t := m.Type().Out(0)
+	if t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+	trace := m.Call(nil)[0]
+	pcs := make([]uintptr, trace.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(trace.Index(i).Uint())
+	}
+	return stackFrames(pcs)
+}
+
+// resolve returns the representation of a value in a log message
+// for the types that are not represented by their JSON encoding,
+// e.g. errors. The elements of slices, arrays and maps with string
+// keys are resolved in a copy, except those of Fields objects
+// and []Fields, they are walked by the formatters. Other values
+// are returned unchanged.
+func resolve(v interface{}) interface{} {
+	switch v.(type) {
+	case ErrorMarshaler, FieldsMarshaler, error:
+		// the methods may not handle nil receivers
+		if isNilPointer(v) {
+			return nil
+		}
+	}
+
+	switch v := v.(type) {
+	case *LazyValue:
+		return resolve(v.Value())
+	case ErrorMarshaler:
+		return v.MarshalLogError()
+	case FieldsMarshaler:
+		return v.MarshalLogFields()
+	case json.Marshaler:
+		return v
+	case error:
+		return errorValue(v)
+	case []error:
+		list := make([]interface{}, len(v))
+		for i, err := range v {
+			if err != nil {
+				list[i] = errorValue(err)
+			}
+		}
+		return list
+	case Fields, []Fields:
+		return v
+	}
+
+	if v != nil && resolvable(reflect.TypeOf(v)) {
+		return transform(v, nil, func(v interface{}, path []string) (interface{}, bool) {
+			return resolve(v), false
+		})
+	}
+	return v
+}
+
+var (
+	lazyType           = reflect.TypeOf((*LazyValue)(nil))
+	errorMarshalerType = reflect.TypeOf((*ErrorMarshaler)(nil)).Elem()
+)
+
+// resolvable reports whether t is a slice, an array or a map
+// with string keys whose elements may have to be resolved.
+func resolvable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return false
+		}
+	case reflect.Slice, reflect.Array:
+	default:
+		return false
+	}
+
+	e := t.Elem()
+	switch e.Kind() {
+	case reflect.Interface, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return e == lazyType || e.Implements(errorType) ||
+		e.Implements(errorMarshalerType) || e.Implements(fieldsMarshalerType)
+}
+
+// isNilPointer reports whether v is a nil pointer.
+func isNilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
@@ -0,0 +1,194 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/szxp/log"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+type codeError struct {
+	code int
+}
+
+func (e *codeError) Error() string {
+	return fmt.Sprintf("code %d", e.code)
+}
+
+func (e *codeError) MarshalLogError() log.Fields {
+	return log.Fields{"code": e.code}
+}
+
+// valueError is an error with a value receiver.
+type valueError struct {
+	msg string
+}
+
+func (e valueError) Error() string {
+	return e.msg
+}
+
+// stackError exposes a stack trace like the
+// errors of github.com/pkg/errors.
+type stackError struct {
+	pcs []uintptr
+}
+
+type frame uintptr
+
+func (e *stackError) Error() string {
+	return "with stack"
+}
+
+func (e *stackError) StackTrace() []frame {
+	frames := make([]frame, len(e.pcs))
+	for i, pc := range e.pcs {
+		frames[i] = frame(pc)
+	}
+	return frames
+}
+
+// joinError wraps multiple errors like errors.Join.
+type joinError []error
+
+func (e joinError) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+func (e joinError) Unwrap() []error {
+	return e
+}
+
+func newStackError() error {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(1, pcs)
+	return &stackError{pcs[:n]}
+}
+
+func TestErrorValues(t *testing.T) {
+	t.Parallel()
+
+	base := errors.New("connection refused")
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{base, `"connection refused"`},
+		{
+			fmt.Errorf("dial: %w", base),
+			`{"causes":["connection refused"],"message":"dial: connection refused"}`,
+		},
+		{
+			fmt.Errorf("query: %w", fmt.Errorf("dial: %w", base)),
+			`{"causes":[{"causes":["connection refused"],"message":"dial: connection refused"}],"message":"query: dial: connection refused"}`,
+		},
+		{
+			joinError{base, &codeError{42}},
+			`{"causes":["connection refused",{"code":42}],"message":"connection refused\ncode 42"}`,
+		},
+		{&codeError{7}, `{"code":7}`},
+		{(*codeError)(nil), `null`},
+		{fmt.Errorf("wrap: %w", (*codeError)(nil)), `{"causes":[null],"message":"wrap: \u003cnil\u003e"}`},
+	}
+
+	for _, test := range tests {
+		b, err := json.Marshal(log.Fields{"error": test.err, "_sort": true})
+		if err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+		expected := `{"error":` + test.expected + `}`
+		if string(b) != expected {
+			t.Fatalf("expected %q, but got %q", expected, b)
+		}
+	}
+}
+
+func TestErrorValuesNested(t *testing.T) {
+	t.Parallel()
+
+	fields := log.Fields{
+		"list":  []interface{}{errors.New("a"), []interface{}{errors.New("b")}},
+		"map":   map[string]interface{}{"error": errors.New("c")},
+		"errs":  []error{errors.New("d"), (*codeError)(nil)},
+		"typed": map[string]error{"x": errors.New("e")},
+		"ptrs":  []*codeError{{code: 1}, nil},
+		"vals":  map[string][]valueError{"v": {{"f"}}},
+		"strs":  []string{"g"},
+		"_sort": true,
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	expected := `{"errs":["d",null],"list":["a",["b"]],"map":{"error":"c"},"ptrs":[{"code":1},null],"strs":["g"],"typed":{"x":"e"},"vals":{"v":["f"]}}`
+	if string(b) != expected {
+		t.Fatalf("expected %q, but got %q", expected, b)
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	t.Parallel()
+
+	b, err := json.Marshal(log.Fields{"error": newStackError()})
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+
+	var actual struct {
+		Error struct {
+			Message string
+			Stack   []struct {
+				Func string
+				File string
+				Line int
+			}
+		}
+	}
+	err = json.Unmarshal(b, &actual)
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	if actual.Error.Message != "with stack" || len(actual.Error.Stack) < 2 {
+		t.Fatalf("unexpected error: %s", b)
+	}
+	if f := actual.Error.Stack[0]; f.Func != "github.com/szxp/log_test.newStackError" ||
+		!strings.HasSuffix(f.File, "error_test.go") || f.Line == 0 {
+		t.Fatalf("unexpected frame: %+v", f)
+	}
+	if f := actual.Error.Stack[1]; f.Func != "github.com/szxp/log_test.TestErrorStack" {
+		t.Fatalf("unexpected frame: %+v", f)
+	}
+}
+
+func TestErrorValuesFormatters(t *testing.T) {
+	t.Parallel()
+
+	fields := log.Fields{"msg": "failed", "error": fmt.Errorf("dial: %w", errors.New("refused"))}
+
+	b, err := (&log.GELFFormatter{Host: "h"}).Format(fields)
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	if !strings.Contains(string(b), `"_error.message":"dial: refused"`) {
+		t.Fatalf("expected the error message, but got: %s", b)
+	}
+
+	b, err = (&log.SyslogFormatter{}).Format(fields)
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	if !strings.Contains(string(b), `error.message="dial: refused"`) {
+		t.Fatalf("expected the error message, but got: %s", b)
+	}
+}
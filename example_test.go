@@ -27,7 +27,7 @@ func Example() {
 
 	// create a logger
 	logger := log.LoggerConfig{
-		// TimeFormat: time.RFC3339,      // optional, see standard time package for custom formats
+		// Time:       true,              // optional, add the time, see TimeEncoding for the formats
 
 		Name:       "loggername",      // optional, name of the logger
 		UTC:        true,              // optional, use UTC rather than local time zone
@@ -0,0 +1,15 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"time"
+)
+
+// SetSampleClock replaces the clock of a filter
+// returned by Sample.
+func SetSampleClock(f Filter, now func() time.Time) {
+	f.(*sample).now = now
+}
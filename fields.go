@@ -0,0 +1,745 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Merge strategies of Fields.Merge, they decide which value
+// is kept if both Fields objects have a value at a path.
+const (
+	// MergeReplace keeps the value of the merged Fields.
+	MergeReplace = iota
+
+	// MergeKeep keeps the existing value.
+	MergeKeep
+
+	// MergeAppend appends the merged slice to the existing
+	// slice if both values are []interface{}, other values
+	// are replaced.
+	MergeAppend
+)
+
+// SplitPath splits a dot-separated path into field names.
+// A backslash escapes the next character, e.g. the path
+// `http.headers.x\.request\.id` has the field names "http",
+// "headers" and "x.request.id". Elements that are non-negative
+// integers index slices, e.g. "items.0.id".
+//
+// The filters, processors and formatters of this package
+// accept paths in this syntax.
+func SplitPath(path string) []string {
+	var fields []string
+	buf := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '\\':
+			if i+1 < len(path) {
+				i++
+				c = path[i]
+			}
+			buf = append(buf, c)
+		case '.':
+			fields = append(fields, string(buf))
+			buf = buf[:0]
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return append(fields, string(buf))
+}
+
+// JoinPath joins the field names into a dot-separated path,
+// dots and backslashes in the field names are escaped.
+// It is the inverse of SplitPath.
+func JoinPath(path []string) string {
+	escaped := make([]string, len(path))
+	for i, field := range path {
+		escaped[i] = strings.NewReplacer(`\`, `\\`, `.`, `\.`).Replace(field)
+	}
+	return strings.Join(escaped, ".")
+}
+
+// index returns the slice index of a path element.
+func index(field string, n int) (int, bool) {
+	if field == "" || field[0] < '0' || field[0] > '9' {
+		return 0, false
+	}
+	i, err := strconv.Atoi(field)
+	if err != nil || i >= n {
+		return 0, false
+	}
+	return i, true
+}
+
+// Values returns the values at the given path, see SplitPath.
+// A "*" element matches every element of a slice or every
+// field of a Fields object or map, in the order of the
+// indexes or the sorted keys.
+func (f Fields) Values(path []string) []interface{} {
+	if len(path) == 0 {
+		return nil
+	}
+
+	values := []interface{}{f}
+	for _, field := range path {
+		var next []interface{}
+		for _, v := range values {
+			if field == "*" {
+				next = append(next, children(v)...)
+			} else if cv, ok := child(v, field); ok {
+				next = append(next, cv)
+			}
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		values = next
+	}
+	return values
+}
+
+// matchValues reports whether match returns true for the values
+// at the path. If every is true, the rest of the path must
+// match for every element matched by a "*" element, otherwise
+// for any element.
+func matchValues(v interface{}, path []string, every bool, match func(v interface{}) bool) bool {
+	if len(path) == 0 {
+		return match(v)
+	}
+
+	if path[0] != "*" {
+		cv, ok := child(v, path[0])
+		return ok && matchValues(cv, path[1:], every, match)
+	}
+
+	elems := children(v)
+	if len(elems) == 0 {
+		return false
+	}
+	for _, cv := range elems {
+		if matchValues(cv, path[1:], every, match) != every {
+			return !every
+		}
+	}
+	return every
+}
+
+// child returns the value of the container v at the
+// path element field. Lazy values are evaluated.
+func child(v interface{}, field string) (interface{}, bool) {
+	var cv interface{}
+	ok := false
+	switch c := v.(type) {
+	case Fields:
+		cv, ok = c[field]
+	case map[string]interface{}:
+		cv, ok = c[field]
+	case FieldsMarshaler:
+		cv, ok = c.MarshalLogFields()[field]
+	case []interface{}:
+		var i int
+		if i, ok = index(field, len(c)); ok {
+			cv = c[i]
+		}
+	case []Fields:
+		var i int
+		if i, ok = index(field, len(c)); ok {
+			cv = c[i]
+		}
+	default:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			var i int
+			if i, ok = index(field, rv.Len()); ok {
+				cv = rv.Index(i).Interface()
+			}
+		case reflect.Map:
+			if rv.Type().Key().Kind() == reflect.String {
+				e := rv.MapIndex(reflect.ValueOf(field).Convert(rv.Type().Key()))
+				if ok = e.IsValid(); ok {
+					cv = e.Interface()
+				}
+			}
+		}
+	}
+	if lv, isLazy := cv.(*LazyValue); isLazy {
+		cv = lv.Value()
+	}
+	return cv, ok
+}
+
+// children returns the elements of a slice or the values of
+// the fields of a Fields object or map in the order of their
+// keys. Lazy values are evaluated.
+func children(v interface{}) []interface{} {
+	if m, ok := v.(FieldsMarshaler); ok {
+		v = m.MarshalLogFields()
+	}
+
+	var fields []string
+	switch c := v.(type) {
+	case Fields:
+		for k := range c {
+			if len(k) == 0 || k[0] != '_' {
+				fields = append(fields, k)
+			}
+		}
+	default:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				fields = append(fields, strconv.Itoa(i))
+			}
+		case reflect.Map:
+			if rv.Type().Key().Kind() != reflect.String {
+				return nil
+			}
+			for _, k := range rv.MapKeys() {
+				fields = append(fields, k.String())
+			}
+		}
+	}
+	if _, ok := v.([]interface{}); !ok {
+		sort.Strings(fields)
+	}
+
+	values := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		if cv, ok := child(v, field); ok {
+			values = append(values, cv)
+		}
+	}
+	return values
+}
+
+// transform returns a copy of the container v in which every
+// element is replaced with the value returned by f. f is called
+// with the element and its path, the path of v followed by the
+// field name or the index of the element. If f returns true, the
+// elements of the returned value are transformed as well.
+//
+// Fields objects, maps with string keys, slices and arrays are
+// copied, their types are kept unless a new element cannot be
+// stored in them, then a map[string]interface{} or a
+// []interface{} is returned. The keys of Fields objects that
+// begin with underscore are copied as is. Other values are
+// returned unchanged.
+func transform(v interface{}, path []string, f func(v interface{}, path []string) (interface{}, bool)) interface{} {
+	elem := func(field string, ev interface{}) interface{} {
+		p := append(path[:len(path):len(path)], field)
+		nv, descend := f(ev, p)
+		if descend {
+			nv = transform(nv, p, f)
+		}
+		return nv
+	}
+
+	switch c := v.(type) {
+	case Fields:
+		t := make(Fields, len(c))
+		for k, ev := range c {
+			if len(k) > 0 && k[0] == '_' {
+				t[k] = ev
+				continue
+			}
+			t[k] = elem(k, ev)
+		}
+		return t
+	case map[string]interface{}:
+		t := make(map[string]interface{}, len(c))
+		for k, ev := range c {
+			t[k] = elem(k, ev)
+		}
+		return t
+	case []interface{}:
+		t := make([]interface{}, len(c))
+		for i, ev := range c {
+			t[i] = elem(strconv.Itoa(i), ev)
+		}
+		return t
+	case []byte:
+		return v
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return v
+		}
+		values := make([]interface{}, rv.Len())
+		typed := true
+		for i := range values {
+			values[i] = elem(strconv.Itoa(i), rv.Index(i).Interface())
+			typed = typed && assignable(values[i], rv.Type().Elem())
+		}
+		if !typed {
+			return values
+		}
+		t := reflect.New(rv.Type()).Elem()
+		if rv.Kind() == reflect.Slice {
+			t = reflect.MakeSlice(rv.Type(), len(values), len(values))
+		}
+		for i, ev := range values {
+			if ev != nil {
+				t.Index(i).Set(reflect.ValueOf(ev))
+			}
+		}
+		return t.Interface()
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String || rv.IsNil() {
+			return v
+		}
+		values := make(map[string]interface{}, rv.Len())
+		typed := true
+		iter := rv.MapRange()
+		for iter.Next() {
+			k := iter.Key().String()
+			values[k] = elem(k, iter.Value().Interface())
+			typed = typed && assignable(values[k], rv.Type().Elem())
+		}
+		if !typed {
+			return values
+		}
+		t := reflect.MakeMapWithSize(rv.Type(), len(values))
+		for k, ev := range values {
+			ov := reflect.Zero(rv.Type().Elem())
+			if ev != nil {
+				ov = reflect.ValueOf(ev)
+			}
+			t.SetMapIndex(reflect.ValueOf(k).Convert(rv.Type().Key()), ov)
+		}
+		return t.Interface()
+	}
+	return v
+}
+
+// assignable reports whether v can be stored in a value of type t.
+func assignable(v interface{}, t reflect.Type) bool {
+	if v == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return true
+		}
+		return false
+	}
+	return reflect.TypeOf(v).AssignableTo(t)
+}
+
+// Set sets the value at the given path. Missing intermediate
+// Fields objects are created, values that are not Fields
+// objects, maps with string keys, slices or arrays along the
+// path are replaced. An index equal to the length of a slice
+// appends to the slice. Containers whose element type cannot
+// hold the new value become []interface{} or
+// map[string]interface{}. It reports whether the value was
+// set, it is not set if an index in the path is out of the
+// range of a slice or an array.
+func (f Fields) Set(path []string, v interface{}) bool {
+	if len(path) == 0 {
+		return false
+	}
+	_, ok := set(f, path, v)
+	return ok
+}
+
+// set returns the container c with the value at the path set to v.
+func set(c interface{}, path []string, v interface{}) (interface{}, bool) {
+	if len(path) == 0 {
+		return v, true
+	}
+
+	field := path[0]
+	var m map[string]interface{}
+	switch c := c.(type) {
+	case Fields:
+		m = c
+	case map[string]interface{}:
+		m = c
+	case []interface{}:
+		i, ok := index(field, len(c)+1)
+		if !ok {
+			return c, false
+		}
+		if i == len(c) {
+			c = append(c, nil)
+		}
+		cv, ok := set(c[i], path[1:], v)
+		if !ok {
+			return c, false
+		}
+		c[i] = cv
+		return c, true
+	default:
+		rv := reflect.ValueOf(c)
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			return setElem(rv, path, v)
+		case reflect.Map:
+			if rv.Type().Key().Kind() == reflect.String {
+				return setMapElem(rv, path, v)
+			}
+		}
+		cv, _ := set(nil, path[1:], v)
+		return Fields{field: cv}, true
+	}
+
+	cv, ok := set(m[field], path[1:], v)
+	if ok {
+		m[field] = cv
+	}
+	return c, ok
+}
+
+// setElem returns the slice or array rv with the value at the
+// path set to v. If the new element cannot be stored in rv,
+// a []interface{} is returned.
+func setElem(rv reflect.Value, path []string, v interface{}) (interface{}, bool) {
+	n := rv.Len()
+	if rv.Kind() == reflect.Slice {
+		n++
+	}
+	i, ok := index(path[0], n)
+	if !ok {
+		return rv.Interface(), false
+	}
+	var cv interface{}
+	if i < rv.Len() {
+		cv = rv.Index(i).Interface()
+	}
+	cv, ok = set(cv, path[1:], v)
+	if !ok {
+		return rv.Interface(), false
+	}
+
+	t := rv.Type().Elem()
+	if !assignable(cv, t) {
+		s := make([]interface{}, rv.Len(), rv.Len()+1)
+		for j := range s {
+			s[j] = rv.Index(j).Interface()
+		}
+		if i == len(s) {
+			return append(s, cv), true
+		}
+		s[i] = cv
+		return s, true
+	}
+	if i == rv.Len() {
+		return reflect.Append(rv, valueOf(cv, t)).Interface(), true
+	}
+	if rv.Kind() == reflect.Array {
+		// arrays in interfaces cannot be modified
+		a := reflect.New(rv.Type()).Elem()
+		a.Set(rv)
+		rv = a
+	}
+	rv.Index(i).Set(valueOf(cv, t))
+	return rv.Interface(), true
+}
+
+// setMapElem returns the map with string keys rv with the value
+// at the path set to v. If the new element cannot be stored in
+// rv, a map[string]interface{} is returned.
+func setMapElem(rv reflect.Value, path []string, v interface{}) (interface{}, bool) {
+	t := rv.Type()
+	key := reflect.ValueOf(path[0]).Convert(t.Key())
+	var cv interface{}
+	if e := rv.MapIndex(key); e.IsValid() {
+		cv = e.Interface()
+	}
+	cv, ok := set(cv, path[1:], v)
+	if !ok {
+		return rv.Interface(), false
+	}
+
+	if !assignable(cv, t.Elem()) {
+		m := make(map[string]interface{}, rv.Len()+1)
+		iter := rv.MapRange()
+		for iter.Next() {
+			m[iter.Key().String()] = iter.Value().Interface()
+		}
+		m[path[0]] = cv
+		return m, true
+	}
+	if rv.IsNil() {
+		rv = reflect.MakeMap(t)
+	}
+	rv.SetMapIndex(key, valueOf(cv, t.Elem()))
+	return rv.Interface(), true
+}
+
+// valueOf returns v as a value that can be stored in t.
+func valueOf(v interface{}, t reflect.Type) reflect.Value {
+	if v == nil {
+		return reflect.Zero(t)
+	}
+	return reflect.ValueOf(v)
+}
+
+// Delete deletes the value at the given path, elements of
+// slices are removed. It reports whether the path existed.
+func (f Fields) Delete(path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	_, ok := del(f, path)
+	return ok
+}
+
+// del returns the container c without the value at the path.
+func del(c interface{}, path []string) (interface{}, bool) {
+	field := path[0]
+	var m map[string]interface{}
+	switch c := c.(type) {
+	case Fields:
+		m = c
+	case map[string]interface{}:
+		m = c
+	case []Fields:
+		i, ok := index(field, len(c))
+		if !ok {
+			return c, false
+		}
+		if len(path) == 1 {
+			return append(c[:i:i], c[i+1:]...), true
+		}
+		_, ok = del(c[i], path[1:])
+		return c, ok
+	case []interface{}:
+		i, ok := index(field, len(c))
+		if !ok {
+			return c, false
+		}
+		if len(path) == 1 {
+			return append(c[:i:i], c[i+1:]...), true
+		}
+		cv, ok := del(c[i], path[1:])
+		c[i] = cv
+		return c, ok
+	default:
+		return c, false
+	}
+
+	cv, ok := m[field]
+	if !ok {
+		return c, false
+	}
+	if len(path) == 1 {
+		delete(m, field)
+		return c, true
+	}
+	cv, ok = del(cv, path[1:])
+	m[field] = cv
+	return c, ok
+}
+
+// Merge merges the src Fields object into this one, nested
+// Fields objects are merged recursively. The strategy is
+// MergeReplace, MergeKeep or MergeAppend. The values of
+// src are cloned, src is not modified.
+func (f Fields) Merge(src Fields, strategy int) {
+	for k, sv := range src {
+		dv, ok := f[k]
+		if !ok {
+			f[k] = clone(sv)
+			continue
+		}
+
+		dm, dok := dv.(Fields)
+		sm, sok := sv.(Fields)
+		if dok && sok {
+			dm.Merge(sm, strategy)
+			continue
+		}
+
+		switch strategy {
+		case MergeKeep:
+		case MergeAppend:
+			ds, dok := dv.([]interface{})
+			ss, sok := sv.([]interface{})
+			if dok && sok {
+				f[k] = append(ds[:len(ds):len(ds)], clone(ss).([]interface{})...)
+				continue
+			}
+			f[k] = clone(sv)
+		default:
+			f[k] = clone(sv)
+		}
+	}
+}
+
+// Clone returns a deep copy of the Fields object. Nested
+// Fields objects, maps and slices are copied, other
+// values are not.
+func (f Fields) Clone() Fields {
+	return clone(f).(Fields)
+}
+
+func clone(v interface{}) interface{} {
+	switch v := v.(type) {
+	case Fields:
+		c := make(Fields, len(v))
+		for k, cv := range v {
+			c[k] = clone(cv)
+		}
+		return c
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, cv := range v {
+			c[k] = clone(cv)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, cv := range v {
+			c[i] = clone(cv)
+		}
+		return c
+	case []Fields:
+		c := make([]Fields, len(v))
+		for i, cv := range v {
+			c[i] = cv.Clone()
+		}
+		return c
+	}
+	return v
+}
+
+// Flatten returns a Fields object without nested Fields
+// objects, maps with string keys, slices and arrays, their
+// values are at dot-separated paths, e.g. {"user": {"id": 1},
+// "tags": ["a"]} is flattened into {"user.id": 1, "tags.0": "a"}.
+// Dots in the field names are escaped, see SplitPath. Top-level
+// keys that begin with underscore are kept, nested ones are
+// skipped. Byte slices are kept, they are strings in JSON.
+func (f Fields) Flatten() Fields {
+	flat := Fields{}
+	for k, v := range f {
+		if len(k) > 0 && k[0] == '_' {
+			flat[k] = v
+			continue
+		}
+		flatten(flat, []string{k}, v)
+	}
+	return flat
+}
+
+func flatten(flat Fields, path []string, v interface{}) {
+	add := func(field string, cv interface{}) {
+		flatten(flat, append(path[:len(path):len(path)], field), cv)
+	}
+
+	switch c := v.(type) {
+	case Fields:
+		if len(c) == 0 {
+			break
+		}
+		for k, cv := range c {
+			if len(k) == 0 || k[0] != '_' {
+				add(k, cv)
+			}
+		}
+		return
+	case map[string]interface{}:
+		if len(c) == 0 {
+			break
+		}
+		for k, cv := range c {
+			add(k, cv)
+		}
+		return
+	case []interface{}:
+		if len(c) == 0 {
+			break
+		}
+		for i, cv := range c {
+			add(strconv.Itoa(i), cv)
+		}
+		return
+	case []byte:
+		// a string in JSON
+	default:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			if rv.Len() == 0 {
+				break
+			}
+			for i := 0; i < rv.Len(); i++ {
+				add(strconv.Itoa(i), rv.Index(i).Interface())
+			}
+			return
+		case reflect.Map:
+			if rv.Len() == 0 || rv.Type().Key().Kind() != reflect.String {
+				break
+			}
+			iter := rv.MapRange()
+			for iter.Next() {
+				add(iter.Key().String(), iter.Value().Interface())
+			}
+			return
+		}
+	}
+	flat[JoinPath(path)] = v
+}
+
+// Unflatten returns a Fields object with nested Fields objects
+// created from the dot-separated paths of the keys. It is the
+// inverse of Flatten, nested Fields objects whose keys are the
+// indexes 0 to n-1 become []interface{} slices. If the path of
+// a key is the prefix of the path of another key, e.g. "a" and
+// "a.b", the value of the shorter path is dropped.
+func (f Fields) Unflatten() Fields {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	u := Fields{}
+	for _, k := range keys {
+		if len(k) > 0 && k[0] == '_' {
+			u[k] = f[k]
+			continue
+		}
+		u.Set(SplitPath(k), f[k])
+	}
+	for k, v := range u {
+		u[k] = slices(v)
+	}
+	return u
+}
+
+// slices converts the nested Fields objects whose
+// keys are the indexes 0 to n-1 into slices.
+func slices(v interface{}) interface{} {
+	f, ok := v.(Fields)
+	if !ok {
+		return v
+	}
+	for k, cv := range f {
+		f[k] = slices(cv)
+	}
+
+	s := make([]interface{}, len(f))
+	for k, cv := range f {
+		i, ok := index(k, len(f))
+		if !ok || strconv.Itoa(i) != k {
+			return f
+		}
+		s[i] = cv
+	}
+	if len(s) == 0 {
+		return f
+	}
+	return s
+}
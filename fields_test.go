@@ -0,0 +1,311 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/szxp/log"
+	"reflect"
+	"testing"
+)
+
+func marshalSorted(t *testing.T, f log.Fields) string {
+	f[log.FieldSort] = true
+	b, err := json.Marshal(f)
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	return string(b)
+}
+
+func TestSplitPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{"a", []string{"a"}},
+		{"a.b.0", []string{"a", "b", "0"}},
+		{`headers.x\.request\.id`, []string{"headers", "x.request.id"}},
+		{`a\\.b`, []string{`a\`, "b"}},
+		{"", []string{""}},
+	}
+	for _, test := range tests {
+		actual := log.SplitPath(test.path)
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Fatalf("expected %q, but got %q", test.expected, actual)
+		}
+		if joined := log.JoinPath(actual); log.JoinPath(log.SplitPath(joined)) != joined {
+			t.Fatalf("JoinPath is not the inverse of SplitPath: %q", joined)
+		}
+	}
+}
+
+func TestFieldsValue(t *testing.T) {
+	t.Parallel()
+
+	fields := log.Fields{
+		"items": []interface{}{log.Fields{"id": 1}, log.Fields{"id": 2}},
+		"x.y":   "dotted",
+	}
+	tests := []struct {
+		path     string
+		expected interface{}
+		exists   bool
+	}{
+		{"items.1.id", 2, true},
+		{"items.2.id", nil, false},
+		{"items.-1", nil, false},
+		{`x\.y`, "dotted", true},
+		{"x.y", nil, false},
+	}
+	for _, test := range tests {
+		v, ok := fields.Value(log.SplitPath(test.path))
+		if ok != test.exists || v != test.expected {
+			t.Fatalf("%s: expected %v %v, but got %v %v", test.path, test.expected, test.exists, v, ok)
+		}
+	}
+
+	match, _ := log.Eq("items.0.id", 1).Match(fields)
+	if !match {
+		t.Fatalf("expected a match")
+	}
+	match, _ = log.FieldExist(`x\.y`).Match(fields)
+	if !match {
+		t.Fatalf("expected a match")
+	}
+}
+
+func TestFieldsValues(t *testing.T) {
+	t.Parallel()
+
+	fields := log.Fields{
+		"items": []log.Fields{{"id": 1}, {"id": 2}, {"name": "x"}},
+		"user":  map[string]interface{}{"b": 2, "a": 1},
+	}
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"items.*.id", "[1 2]"},
+		{"user.*", "[1 2]"},
+		{"items.*.missing", "[]"},
+		{"user.a", "[1]"},
+		{"*.*.name", "[x]"},
+	}
+	for _, test := range tests {
+		v := fmt.Sprint(fields.Values(log.SplitPath(test.path)))
+		if v != test.expected {
+			t.Fatalf("%s: expected %q, but got %q", test.path, test.expected, v)
+		}
+	}
+
+	v, ok := fields.Value(log.SplitPath("items.*.id"))
+	if !ok || v != 1 {
+		t.Fatalf("expected 1 true, but got %v %v", v, ok)
+	}
+}
+
+func TestFieldsSetDelete(t *testing.T) {
+	t.Parallel()
+
+	f := log.Fields{"user": log.Fields{"id": 1}, "items": []interface{}{"a", "b", "c"}, "s": "str"}
+	f.Set(log.SplitPath("user.name"), "joe")
+	f.Set(log.SplitPath("a.b.c"), 1)
+	f.Set(log.SplitPath("items.1"), "B")
+	f.Set(log.SplitPath("items.3"), "d")
+	f.Set(log.SplitPath("s.t"), 2)
+	if f.Set(log.SplitPath("items.9"), "j") {
+		t.Fatalf("expected out of range index not to be set")
+	}
+
+	expected := `{"a":{"b":{"c":1}},"items":["a","B","c","d"],"s":{"t":2},"user":{"id":1,"name":"joe"}}`
+	if actual := marshalSorted(t, f); actual != expected {
+		t.Fatalf("expected %q, but got %q", expected, actual)
+	}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"user.id", true},
+		{"items.0", true},
+		{"items.9", false},
+		{"missing.path", false},
+		{"a", true},
+	}
+	for _, test := range tests {
+		if actual := f.Delete(log.SplitPath(test.path)); actual != test.expected {
+			t.Fatalf("%s: expected %v, but got %v", test.path, test.expected, actual)
+		}
+	}
+	expected = `{"items":["B","c","d"],"s":{"t":2},"user":{"name":"joe"}}`
+	if actual := marshalSorted(t, f); actual != expected {
+		t.Fatalf("expected %q, but got %q", expected, actual)
+	}
+}
+
+func TestFieldsSetTyped(t *testing.T) {
+	t.Parallel()
+
+	f := log.Fields{
+		"tags":   []string{"a", "b"},
+		"pair":   [2]int{1, 2},
+		"labels": map[string]string{"env": "prod"},
+		"ids":    []int{1},
+	}
+	tests := []struct {
+		path     string
+		value    interface{}
+		expected bool
+	}{
+		{"tags.1", "z", true},
+		{"tags.2", "c", true},
+		{"tags.9", "x", false},
+		{"pair.0", 3, true},
+		{"pair.2", 4, false},
+		{"labels.region", "eu", true},
+		{"ids.0", "one", true},
+	}
+	for _, test := range tests {
+		if actual := f.Set(log.SplitPath(test.path), test.value); actual != test.expected {
+			t.Fatalf("%s: expected %v, but got %v", test.path, test.expected, actual)
+		}
+	}
+
+	expected := log.Fields{
+		"tags":   []string{"a", "z", "c"},
+		"pair":   [2]int{3, 2},
+		"labels": map[string]string{"env": "prod", "region": "eu"},
+		// the element type cannot hold a string
+		"ids": []interface{}{"one"},
+	}
+	if !reflect.DeepEqual(f, expected) {
+		t.Fatalf("expected %v, but got %v", expected, f)
+	}
+}
+
+func TestFieldsSetDeleteFieldsSlice(t *testing.T) {
+	t.Parallel()
+
+	f := log.Fields{"users": []log.Fields{{}, {"id": 2}, {"id": 3}}}
+	f.Set(log.SplitPath("users.0.name"), "joe")
+	f.Set(log.SplitPath("users.3"), log.Fields{"id": 4})
+	if f.Set(log.SplitPath("users.9.id"), 10) {
+		t.Fatalf("expected out of range index not to be set")
+	}
+	if _, ok := f["users"].([]log.Fields); !ok {
+		t.Fatalf("expected []log.Fields, but got %T", f["users"])
+	}
+	if !f.Delete(log.SplitPath("users.1")) || !f.Delete(log.SplitPath("users.1.id")) {
+		t.Fatalf("expected the paths to exist")
+	}
+	if f.Delete(log.SplitPath("users.3")) {
+		t.Fatalf("expected out of range index not to exist")
+	}
+
+	expected := `{"users":[{"name":"joe"},{},{"id":4}]}`
+	if actual := marshalSorted(t, f); actual != expected {
+		t.Fatalf("expected %q, but got %q", expected, actual)
+	}
+
+	// elements that are not Fields objects convert the slice
+	f.Set(log.SplitPath("users.1"), "none")
+	expected = `{"users":[{"name":"joe"},"none",{"id":4}]}`
+	if actual := marshalSorted(t, f); actual != expected {
+		t.Fatalf("expected %q, but got %q", expected, actual)
+	}
+}
+
+func TestFieldsMerge(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		strategy int
+		expected string
+	}{
+		{log.MergeReplace, `{"a":2,"list":[3],"user":{"id":2,"name":"joe","role":"admin"}}`},
+		{log.MergeKeep, `{"a":1,"list":[1,2],"user":{"id":1,"name":"joe","role":"admin"}}`},
+		{log.MergeAppend, `{"a":2,"list":[1,2,3],"user":{"id":2,"name":"joe","role":"admin"}}`},
+	}
+	for _, test := range tests {
+		dst := log.Fields{"a": 1, "list": []interface{}{1, 2}, "user": log.Fields{"id": 1, "name": "joe"}}
+		src := log.Fields{"a": 2, "list": []interface{}{3}, "user": log.Fields{"id": 2, "role": "admin"}}
+		dst.Merge(src, test.strategy)
+		if actual := marshalSorted(t, dst); actual != test.expected {
+			t.Fatalf("expected %q, but got %q", test.expected, actual)
+		}
+		if actual := marshalSorted(t, src); actual != `{"a":2,"list":[3],"user":{"id":2,"role":"admin"}}` {
+			t.Fatalf("src modified: %q", actual)
+		}
+	}
+}
+
+func TestFieldsClone(t *testing.T) {
+	t.Parallel()
+
+	f := log.Fields{"user": log.Fields{"id": 1}, "items": []interface{}{log.Fields{"id": 2}}}
+	c := f.Clone()
+	c.Set(log.SplitPath("user.id"), 3)
+	c.Set(log.SplitPath("items.0.id"), 4)
+
+	expected := `{"items":[{"id":2}],"user":{"id":1}}`
+	if actual := marshalSorted(t, f); actual != expected {
+		t.Fatalf("expected %q, but got %q", expected, actual)
+	}
+}
+
+func TestFieldsFlatten(t *testing.T) {
+	t.Parallel()
+
+	f := log.Fields{
+		"user":  log.Fields{"id": 1, "x.y": true},
+		"items": []interface{}{"a", log.Fields{"id": 2}},
+		"empty": log.Fields{},
+		"_sort": true,
+	}
+	flat := f.Flatten()
+	expected := log.Fields{
+		"user.id":    1,
+		`user.x\.y`:  true,
+		"items.0":    "a",
+		"items.1.id": 2,
+		"empty":      log.Fields{},
+		"_sort":      true,
+	}
+	if !reflect.DeepEqual(flat, expected) {
+		t.Fatalf("expected %v, but got %v", expected, flat)
+	}
+
+	if actual := flat.Unflatten(); !reflect.DeepEqual(actual, f) {
+		t.Fatalf("expected %v, but got %v", f, actual)
+	}
+
+	typed := log.Fields{
+		"tags":   []string{"a", "b"},
+		"pair":   [2]int{1, 2},
+		"labels": map[string]string{"env": "prod"},
+		"raw":    []byte("raw"),
+	}
+	expected = log.Fields{
+		"tags.0":     "a",
+		"tags.1":     "b",
+		"pair.0":     1,
+		"pair.1":     2,
+		"labels.env": "prod",
+		"raw":        []byte("raw"),
+	}
+	if flat := typed.Flatten(); !reflect.DeepEqual(flat, expected) {
+		t.Fatalf("expected %v, but got %v", expected, flat)
+	}
+
+	// the value of the shorter path is dropped
+	conflict := log.Fields{"a": 1, "a.b": 2}.Unflatten()
+	if expected := (log.Fields{"a": log.Fields{"b": 2}}); !reflect.DeepEqual(conflict, expected) {
+		t.Fatalf("expected %v, but got %v", expected, conflict)
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// FluentFormatter converts a log message into a MessagePack
+// encoded Fluentd event, [tag, time, record], as it appears
+// in the Message mode of the Forward protocol,
+// see https://github.com/fluent/fluentd/wiki/Forward-Protocol-Specification-v1
+//
+// The tag is derived from the value at the key FieldLogger,
+// the time is taken from the value at the key FieldTime and
+// written as an EventTime. The record contains all of the
+// fields, keys that begin with underscore will be skipped.
+//
+// FluentFormatter is safe for concurrent use by multiple goroutines.
+type FluentFormatter struct {
+	// Tag is the tag of the events. If the log message has a
+	// logger name the tag is Tag + "." + logger name.
+	// If empty, "log" will be used.
+	Tag string
+
+	// TimeEncoding specifies how the times and durations
+	// of the record are encoded.
+	TimeEncoding TimeEncoding
+}
+
+// Format returns the fields as a Fluentd event.
+func (f *FluentFormatter) Format(fields Fields) ([]byte, error) {
+	tag := f.Tag
+	if tag == "" {
+		tag = "log"
+	}
+	if name, ok := fields[FieldLogger].(string); ok && name != "" {
+		tag += "." + name
+	}
+
+	b := []byte{0x93}
+	b = appendMsgpackString(b, tag)
+	b = appendMsgpackEventTime(b, timestamp(fields))
+	return appendMsgpack(b, f.TimeEncoding.Fields(fields))
+}
+
+// FluentConfig can be used to create a new FluentWriter.
+type FluentConfig struct {
+	// Network is the network of the Forward input. If empty,
+	// "tcp" will be used.
+	Network string
+
+	// Address of the Forward input, e.g. "localhost:24224".
+	Address string
+
+	// RequireAck requests an acknowledgement of every chunk of
+	// events from the server. Chunks that are not acknowledged
+	// are resent, that results in at-least-once delivery.
+	RequireAck bool
+
+	// Timeout of connecting, writing a chunk and waiting for
+	// its acknowledgement. If zero, 5 seconds will be used.
+	Timeout time.Duration
+
+	// BatchConfig configures the batching and the retries.
+	// If zero, BatchCount is 1000 and BatchBytes is 1 MB.
+	// Chunks that cannot be sent or are not acknowledged are
+	// retried, the connection is reestablished before every
+	// retry.
+	BatchConfig
+}
+
+// NewWriter creates and returns a new FluentWriter.
+func (c FluentConfig) NewWriter() *FluentWriter {
+	if c.Network == "" {
+		c.Network = "tcp"
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 5 * time.Second
+	}
+	c.BatchConfig = c.BatchConfig.withDefaults(1000, 1<<20)
+
+	w := &FluentWriter{config: c}
+	w.batcher = newBatcher(c.BatchConfig, w.send)
+	return w
+}
+
+// FluentWriter writes log messages formatted by the FluentFormatter
+// to a Fluentd or Fluent Bit Forward input in batches. The events
+// of a batch are grouped by their tags and sent in PackedForward
+// mode, a chunk per tag.
+//
+// Batches are sent from a background goroutine. Errors that
+// occur while sending are reported to the error handler
+// registered with OnError.
+//
+// FluentWriter is safe for concurrent use by multiple goroutines.
+type FluentWriter struct {
+	config  FluentConfig
+	batcher *batcher
+
+	// used by the goroutine sending the batches only
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Write buffers the log message.
+func (w *FluentWriter) Write(b []byte) (int, error) {
+	return w.batcher.Write(b)
+}
+
+// Flush sends the buffered log messages.
+func (w *FluentWriter) Flush() error {
+	return w.batcher.Flush()
+}
+
+// Close flushes the buffered log messages, stops the
+// background goroutine and closes the connection.
+func (w *FluentWriter) Close() error {
+	err := w.batcher.Close()
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+func (w *FluentWriter) notifyErrors(f func(err error)) {
+	w.batcher.notifyErrors(f)
+}
+
+func (w *FluentWriter) send(lines [][]byte) error {
+	var tags []string
+	entries := make(map[string][]byte)
+	counts := make(map[string]int)
+
+	for _, line := range lines {
+		// [tag, time, record] -> [time, record]
+		r := bytes.NewReader(line)
+		c, err := r.ReadByte()
+		if err != nil || c != 0x93 {
+			return errors.New("log: invalid fluent event")
+		}
+		tag, err := readMsgpackString(r)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := entries[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		entries[tag] = append(append(entries[tag], 0x92), line[len(line)-r.Len():]...)
+		counts[tag]++
+	}
+
+	for _, tag := range tags {
+		err := w.sendChunk(tag, entries[tag], counts[tag])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendChunk sends the entries in PackedForward mode.
+func (w *FluentWriter) sendChunk(tag string, entries []byte, count int) error {
+	chunk := ""
+	msg := []byte{0x93}
+	msg = appendMsgpackString(msg, tag)
+	msg = appendMsgpackBinary(msg, entries)
+	if w.config.RequireAck {
+		id := make([]byte, 16)
+		_, err := io.ReadFull(rand.Reader, id)
+		if err != nil {
+			return err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id)
+
+		msg = append(msg, 0x82)
+		msg = appendMsgpackString(msg, "size")
+		msg = appendMsgpackUint(msg, uint64(count))
+		msg = appendMsgpackString(msg, "chunk")
+		msg = appendMsgpackString(msg, chunk)
+	} else {
+		msg = append(msg, 0x81)
+		msg = appendMsgpackString(msg, "size")
+		msg = appendMsgpackUint(msg, uint64(count))
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if attempt > w.config.MaxRetries {
+				return fmt.Errorf("log: fluent: %d events dropped after %d attempts: %v", count, attempt, err)
+			}
+			time.Sleep(backoff(w.config.RetryBackoff, attempt-1))
+		}
+
+		err = w.write(msg, chunk)
+		if err == nil {
+			return nil
+		}
+
+		// reconnect before the retry
+		if w.conn != nil {
+			w.conn.Close()
+			w.conn = nil
+		}
+	}
+}
+
+func (w *FluentWriter) write(msg []byte, chunk string) error {
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.config.Network, w.config.Address, w.config.Timeout)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+		w.r = bufio.NewReader(conn)
+	}
+
+	err := w.conn.SetDeadline(time.Now().Add(w.config.Timeout))
+	if err != nil {
+		return err
+	}
+	_, err = w.conn.Write(msg)
+	if err != nil || chunk == "" {
+		return err
+	}
+
+	// {"ack": chunk}
+	n, err := readMsgpackMapHeader(w.r)
+	if err != nil {
+		return err
+	}
+	ack := ""
+	for i := 0; i < n; i++ {
+		k, err := readMsgpackString(w.r)
+		if err != nil {
+			return err
+		}
+		v, err := readMsgpackString(w.r)
+		if err != nil {
+			return err
+		}
+		if k == "ack" {
+			ack = v
+		}
+	}
+	if ack != chunk {
+		return fmt.Errorf("log: fluent: unexpected ack: %q", ack)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"github.com/szxp/log"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFluentFormatter(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		fields   log.Fields
+		expected string
+	}{
+		{"tag", log.Fields{"time": "2017-03-04T10:20:30.5Z"},
+			"\x93\xa3log\xd7\x00\x58\xba\x94\xee\x1d\xcd\x65\x00\x81\xa4time\xb62017-03-04T10:20:30.5Z"},
+		{"logger tag", log.Fields{"time": "2017-03-04T10:20:30Z", "logger": "app", "n": -1, "ok": true, "_skip": 1},
+			"\x93\xa7log.app\xd7\x00\x58\xba\x94\xee\x00\x00\x00\x00" +
+				"\x84\xa6logger\xa3app\xa1n\xff\xa2ok\xc3\xa4time\xb42017-03-04T10:20:30Z"},
+		{"nested", log.Fields{"time": "2017-03-04T10:20:30Z", "user": log.Fields{"id": 300, "tags": []string{"a"}}},
+			"\x93\xa3log\xd7\x00\x58\xba\x94\xee\x00\x00\x00\x00" +
+				"\x82\xa4time\xb42017-03-04T10:20:30Z\xa4user\x82\xa2id\xcd\x01\x2c\xa4tags\x91\xa1a"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			f := log.FluentFormatter{}
+			b, err := f.Format(tc.fields)
+			if err != nil {
+				t.Fatalf("non-nil error: %v", err)
+			}
+
+			if string(b) != tc.expected {
+				t.Fatalf("expected %q, but got: %q", tc.expected, string(b))
+			}
+		})
+	}
+}
+
+func TestFluentWriter(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	defer ln.Close()
+
+	f := &log.FluentFormatter{}
+	var lines [][]byte
+	for _, fields := range []log.Fields{
+		{"time": "2017-03-04T10:20:30Z", "logger": "app", "msg": "a"},
+		{"time": "2017-03-04T10:20:31Z", "logger": "app", "msg": "b"},
+	} {
+		b, err := f.Format(fields)
+		if err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+		lines = append(lines, b)
+	}
+
+	// PackedForward mode: [tag, entries, {"size": 2, "chunk": id}]
+	var entries []byte
+	for _, line := range lines {
+		entries = append(entries, 0x92)
+		entries = append(entries, line[len("\x93\xa7log.app"):]...)
+	}
+	expected := "\x93\xa7log.app\xc4" + string([]byte{byte(len(entries))}) + string(entries) +
+		"\x82\xa4size\x02\xa5chunk\xb8"
+
+	received := make(chan string, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			msg := make([]byte, len(expected)+24)
+			_, err = io.ReadFull(conn, msg)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			received <- string(msg[:len(expected)])
+
+			// the first chunk is not acknowledged
+			if i == 1 {
+				conn.Write(append([]byte("\x81\xa3ack\xb8"), msg[len(expected):]...))
+			}
+			conn.Close()
+		}
+	}()
+
+	w := log.FluentConfig{
+		Address:    ln.Addr().String(),
+		RequireAck: true,
+		BatchConfig: log.BatchConfig{
+			FlushInterval: time.Hour,
+			RetryBackoff:  time.Millisecond,
+		},
+	}.NewWriter()
+	defer w.Close()
+
+	for _, line := range lines {
+		if _, err := w.Write(line); err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if msg := <-received; msg != expected {
+			t.Fatalf("expected %q, but got: %q", expected, msg)
+		}
+	}
+}
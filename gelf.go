@@ -0,0 +1,292 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Compression algorithms supported by writers
+// that can compress the log messages.
+const (
+	CompressionNone = iota
+	CompressionGzip
+	CompressionZlib
+)
+
+// GELFFormatter converts a log message into a GELF 1.1 message,
+// see https://go2docs.graylog.org/current/getting_in_log_data/gelf.html
+//
+// The value at the key FieldMessage is used as short_message.
+// If it spans multiple lines its first line is used as
+// short_message and the whole as full_message. The value at the
+// key FieldLevel is mapped to the syslog severity and the value
+// at the key FieldTime to the timestamp.
+//
+// The rest of the fields are written as additional fields,
+// prefixed with underscore. Nested Fields are flattened with
+// dot-separated names, bools and values other than strings and
+// numbers are written as strings. Keys that begin with
+// underscore will be skipped.
+//
+// GELFFormatter is safe for concurrent use by multiple goroutines.
+type GELFFormatter struct {
+	// Host of the messages. If empty, the hostname
+	// reported by the kernel will be used.
+	Host string
+
+	// TimeEncoding specifies how the times and durations
+	// of the additional fields are encoded.
+	TimeEncoding TimeEncoding
+}
+
+// Format returns the fields as a GELF message.
+func (f *GELFFormatter) Format(fields Fields) ([]byte, error) {
+	host := f.Host
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+
+	msg := ""
+	if v, ok := fields[FieldMessage]; ok {
+		msg = fmt.Sprint(resolve(v))
+	}
+	if msg == "" {
+		msg = "-"
+	}
+
+	t := timestamp(fields)
+	fields = f.TimeEncoding.Fields(fields)
+	m := map[string]interface{}{
+		"version":       "1.1",
+		"host":          host,
+		"short_message": msg,
+		"timestamp":     float64(t.UnixNano()/1e6) / 1e3,
+		"level":         severity(fields[FieldLevel]),
+	}
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		m["short_message"] = msg[:i]
+		m["full_message"] = msg
+	}
+
+	err := addGELFFields(m, "_", fields, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// encoding/json is used rather than Fields.MarshalJSON,
+	// additional fields begin with underscore
+	return json.Marshal(m)
+}
+
+func addGELFFields(m map[string]interface{}, prefix string, fields Fields, top bool) error {
+	for k, v := range fields {
+		if len(k) == 0 || k[0] == '_' {
+			continue
+		}
+		if top && (k == FieldMessage || k == FieldLevel || k == FieldTime) {
+			continue
+		}
+
+		name := prefix + k
+		if top && k == "full_message" {
+			name = k
+		} else if name == "_id" {
+			// reserved by Graylog
+			name = "_id_"
+		}
+
+		switch v := resolve(v).(type) {
+		case Fields:
+			err := addGELFFields(m, name+".", v, false)
+			if err != nil {
+				return err
+			}
+		case string, int, int8, int16, int32, int64, uint, uint8, uint16,
+			uint32, uint64, float32, float64:
+			m[name] = v
+		case nil:
+			m[name] = ""
+		case bool:
+			m[name] = fmt.Sprint(v)
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			m[name] = string(b)
+		}
+	}
+	return nil
+}
+
+// DefaultGELFChunkSize is the default maximum size of
+// a UDP datagram sent by the GELFWriter.
+const DefaultGELFChunkSize = 1420
+
+// GELFWriter writes log messages formatted by the GELFFormatter
+// to a Graylog GELF input over UDP or TCP.
+//
+// Over UDP every log message is sent in its own datagram,
+// optionally compressed. Messages larger than ChunkSize are
+// split into at most 128 chunks. Over TCP messages are
+// delimited by a null byte and cannot be compressed.
+//
+// GELFWriter is safe for concurrent use by multiple goroutines.
+type GELFWriter struct {
+	// Network is either "udp" or "tcp".
+	Network string
+
+	// Address of the GELF input, e.g. "graylog:12201".
+	Address string
+
+	// Compression of the UDP datagrams,
+	// CompressionNone, CompressionGzip or CompressionZlib.
+	Compression int
+
+	// ChunkSize is the maximum size of a UDP datagram.
+	// If zero, DefaultGELFChunkSize will be used. It must be
+	// larger than the 12 bytes of the chunk header, otherwise
+	// the writes fail.
+	ChunkSize int
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+const gelfChunkHeader = 12
+
+// Write writes the log message to the GELF input.
+func (w *GELFWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		conn, err := net.Dial(w.Network, w.Address)
+		if err != nil {
+			return 0, err
+		}
+		w.conn = conn
+	}
+
+	msg := bytes.TrimSuffix(b, []byte{'\n'})
+
+	var err error
+	if isDatagram(w.Network) {
+		err = w.writeUDP(msg)
+	} else {
+		// don't modify b, msg shares its backing array
+		frame := make([]byte, len(msg)+1)
+		copy(frame, msg)
+		_, err = w.conn.Write(frame)
+	}
+	if err != nil {
+		// reconnect on the next write
+		w.conn.Close()
+		w.conn = nil
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (w *GELFWriter) writeUDP(msg []byte) error {
+	msg, err := compress(msg, w.Compression)
+	if err != nil {
+		return err
+	}
+
+	size := w.ChunkSize
+	if size == 0 {
+		size = DefaultGELFChunkSize
+	}
+	if size <= gelfChunkHeader {
+		return fmt.Errorf("log: GELF chunk size too small: %d", size)
+	}
+	if len(msg) <= size {
+		_, err = w.conn.Write(msg)
+		return err
+	}
+
+	size -= gelfChunkHeader
+	count := (len(msg) + size - 1) / size
+	if count > 128 {
+		return errors.New("log: GELF message too large")
+	}
+
+	id := make([]byte, 8)
+	_, err = io.ReadFull(rand.Reader, id)
+	if err != nil {
+		return err
+	}
+
+	chunk := make([]byte, 0, gelfChunkHeader+size)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(msg) {
+			end = len(msg)
+		}
+		chunk = append(chunk[:0], gelfChunkMagic...)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, msg[i*size:end]...)
+		_, err = w.conn.Write(chunk)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connection to the GELF input.
+func (w *GELFWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// compress compresses b with the given compression algorithm.
+func compress(b []byte, compression int) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch compression {
+	case CompressionNone:
+		return b, nil
+	case CompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case CompressionZlib:
+		w = zlib.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("log: unknown compression: %d", compression)
+	}
+
+	_, err := w.Write(b)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/szxp/log"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestGELFFormatter(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		fields   log.Fields
+		expected string
+	}{
+		{"empty", log.Fields{"time": "2017-03-04T10:20:30.125Z"},
+			`{"host":"host1","level":6,"short_message":"-","timestamp":1488622830.125,"version":"1.1"}`},
+		{"message", log.Fields{"time": "2017-03-04T10:20:30Z", "msg": "hello", "level": "warn"},
+			`{"host":"host1","level":4,"short_message":"hello","timestamp":1488622830,"version":"1.1"}`},
+		{"full message", log.Fields{"time": "2017-03-04T10:20:30Z", "msg": "hello\nworld"},
+			`{"full_message":"hello\nworld","host":"host1","level":6,"short_message":"hello","timestamp":1488622830,"version":"1.1"}`},
+		{"additional", log.Fields{"time": "2017-03-04T10:20:30Z", "logger": "app1", "id": 7, "ok": true,
+			"user": log.Fields{"name": "admin"}, "tags": []string{"a"}, "_skip": 1},
+			`{"_id_":7,"_logger":"app1","_ok":"true","_tags":"[\"a\"]","_user.name":"admin","host":"host1","level":6,"short_message":"-","timestamp":1488622830,"version":"1.1"}`},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			f := log.GELFFormatter{Host: "host1"}
+			b, err := f.Format(tc.fields)
+			if err != nil {
+				t.Fatalf("non-nil error: %v", err)
+			}
+
+			if !bytes.Equal(b, []byte(tc.expected)) {
+				t.Fatalf("expected %q, but got: %q", tc.expected, string(b))
+			}
+		})
+	}
+}
+
+func TestGELFWriterUDP(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	defer conn.Close()
+
+	w := &log.GELFWriter{
+		Network:     "udp",
+		Address:     conn.LocalAddr().String(),
+		Compression: log.CompressionGzip,
+		ChunkSize:   100,
+	}
+	defer w.Close()
+
+	// random content, so it is not compressed into a single chunk
+	random := make([]byte, 1000)
+	rand.Read(random)
+	msg := []byte(`{"short_message":"` + hex.EncodeToString(random) + `"}`)
+	_, err = w.Write(append(msg, '\n'))
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+
+	var payload []byte
+	for seq, count := 0, 1; seq < count; seq++ {
+		buf := make([]byte, 1024)
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+		if n > 100 {
+			t.Fatalf("expected at most 100 bytes, but got %d", n)
+		}
+		if buf[0] != 0x1e || buf[1] != 0x0f || int(buf[10]) != seq {
+			t.Fatalf("invalid chunk header: %v", buf[:12])
+		}
+		count = int(buf[11])
+		payload = append(payload, buf[12:n]...)
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	actual, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	if !bytes.Equal(actual, msg) {
+		t.Fatalf("expected %q, but got: %q", msg, actual)
+	}
+}
+
+func TestGELFWriterChunkSize(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	defer conn.Close()
+
+	for _, size := range []int{-1, 1, 12} {
+		w := &log.GELFWriter{
+			Network:   "udp",
+			Address:   conn.LocalAddr().String(),
+			ChunkSize: size,
+		}
+		_, err = w.Write([]byte(`{"short_message":"hello"}` + "\n"))
+		w.Close()
+		if err == nil {
+			t.Fatalf("%d: expected an error", size)
+		}
+	}
+}
+
+func TestGELFWriterTCP(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	defer ln.Close()
+
+	w := &log.GELFWriter{Network: "tcp", Address: ln.Addr().String()}
+	defer w.Close()
+
+	messages := []string{`{"short_message":"hello"}`, `{"short_message":"world"}`}
+	for _, msg := range messages {
+		_, err = w.Write([]byte(msg + "\n"))
+		if err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for _, msg := range messages {
+		actual, err := r.ReadString(0)
+		if err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+		if actual != msg+"\x00" {
+			t.Fatalf("expected %q, but got: %q", msg+"\x00", actual)
+		}
+	}
+}
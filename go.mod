@@ -0,0 +1,3 @@
+module github.com/szxp/log
+
+go 1.19
@@ -0,0 +1,186 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// GroupFailover is a group mode, log messages are written
+	// to the first member that is not down, in the order of
+	// the members.
+	GroupFailover = iota + 1
+
+	// GroupRoundRobin is a group mode, log messages are
+	// distributed evenly among the members that are not down.
+	GroupRoundRobin
+)
+
+// Group describes a group of outputs in the DefaultRouter that
+// act as a single output. A log message is written to one of
+// the members. If it fails, the log message is written to the
+// next member, until one of them succeeds.
+//
+// A member is down after MaxErrors consecutive errors and it is
+// skipped until ProbeInterval elapses. Then the next log message
+// is written to it again as a probe, if it succeeds the member is
+// up again. If all members are down, they are tried nevertheless.
+//
+// Errors of the members are reported to the error handler
+// registered with OnError. If none of the members succeeds, the
+// log message is reported as failed with the Output of the group
+// and written to the dead-letter output, if there is one.
+//
+// The writers of the members should report their errors
+// synchronously. Errors of writers that write log messages
+// asynchronously in batches are only reported.
+type Group struct {
+	// Id identifies the group. It can be used to update
+	// or remove the group like an Output.
+	Id string
+
+	// Mode is GroupFailover or GroupRoundRobin.
+	// If zero, GroupFailover will be used.
+	Mode int
+
+	// Outputs are the members of the group. Their Id
+	// is used in the error reports and the Stats only.
+	Outputs []Output
+
+	// Filter specifies which messages should be written
+	// to the group. It is optional. The members can
+	// have filters as well.
+	Filter Filter
+
+	// MaxErrors is the number of consecutive errors after
+	// which a member is down. If zero, 3 will be used.
+	MaxErrors int
+
+	// ProbeInterval is the time after which a member that is
+	// down is probed again. If zero, 30 seconds will be used.
+	ProbeInterval time.Duration
+}
+
+// Register registers the group in the DefaultRouter. The
+// statistics of an output or a group registered earlier
+// with the same Id are reset.
+func (g Group) Register() {
+	if g.Mode == 0 {
+		g.Mode = GroupFailover
+	}
+	if g.MaxErrors == 0 {
+		g.MaxErrors = 3
+	}
+	if g.ProbeInterval == 0 {
+		g.ProbeInterval = 30 * time.Second
+	}
+
+	gr := &group{
+		mode:          g.Mode,
+		maxErrors:     g.MaxErrors,
+		probeInterval: g.ProbeInterval,
+		health:        make([]health, len(g.Outputs)),
+	}
+	for _, o := range g.Outputs {
+		m := o
+		if m.Formatter == nil {
+			m.Formatter = DefaultFormatter
+		}
+		gr.members = append(gr.members, &m)
+	}
+	DefaultRouter.output(&Output{Id: g.Id, Filter: g.Filter, group: gr})
+}
+
+// errGroupFailed is reported if none of
+// the members of a group succeeds.
+var errGroupFailed = errors.New("log: all outputs of the group failed")
+
+type group struct {
+	mode          int
+	maxErrors     int
+	probeInterval time.Duration
+	members       []*Output
+	health        []health
+	next          int
+}
+
+type health struct {
+	errors int
+	down   time.Time // zero if up
+}
+
+// writeGroup writes the fields to the members of the group
+// until one of them succeeds. Members whose filters do not
+// match the fields are skipped. It reports whether the fields
+// have been written.
+func (l *defaultRouter) writeGroup(g *group, fields Fields) (bool, string, error) {
+	n := len(g.members)
+	if n == 0 {
+		return false, StageWrite, errGroupFailed
+	}
+
+	start := 0
+	if g.mode == GroupRoundRobin {
+		start = g.next
+		g.next = (g.next + 1) % n
+	}
+
+	// the members that are down are tried last
+	now := time.Now()
+	order := make([]int, 0, n)
+	var down []int
+	for i := 0; i < n; i++ {
+		k := (start + i) % n
+		h := g.health[k]
+		if !h.down.IsZero() && now.Sub(h.down) < g.probeInterval {
+			down = append(down, k)
+			continue
+		}
+		order = append(order, k)
+	}
+	order = append(order, down...)
+
+	failed := false
+	for _, k := range order {
+		m, h := g.members[k], &g.health[k]
+		written, _, err := l.write(m, fields)
+		if err == nil {
+			if !written {
+				continue
+			}
+			h.errors = 0
+			h.down = time.Time{}
+			return true, "", nil
+		}
+
+		failed = true
+		m.stats.Errors++
+		if l.errorHandler != nil {
+			l.errorHandler(err, fields, *m)
+		}
+		h.errors++
+		if h.errors >= g.maxErrors {
+			h.down = now
+		}
+	}
+	if !failed {
+		return false, "", nil
+	}
+	return false, StageWrite, errGroupFailed
+}
+
+func (g *group) stats() []OutputStats {
+	stats := make([]OutputStats, len(g.members))
+	now := time.Now()
+	for i, m := range g.members {
+		stats[i] = m.stats
+		stats[i].Id = m.Id
+		h := g.health[i]
+		stats[i].Down = !h.down.IsZero() && now.Sub(h.down) < g.probeInterval
+	}
+	return stats
+}
@@ -0,0 +1,160 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"bytes"
+	"github.com/szxp/log"
+	"testing"
+	"time"
+)
+
+func groupStats(t *testing.T, id string) log.OutputStats {
+	for _, s := range log.Stats() {
+		if s.Id == id {
+			return s
+		}
+	}
+	t.Fatalf("stats not found: %s", id)
+	return log.OutputStats{}
+}
+
+func TestGroupFailover(t *testing.T) {
+	primary := &flakyWriter{fail: true}
+	secondary := &bytes.Buffer{}
+
+	log.Group{
+		Id: "failoverTest",
+		Outputs: []log.Output{
+			{Id: "primary", Writer: primary},
+			{Id: "secondary", Writer: secondary},
+		},
+		Filter:        log.FieldExist("failoverTest"),
+		MaxErrors:     2,
+		ProbeInterval: 50 * time.Millisecond,
+	}.Register()
+	defer log.Output{Id: "failoverTest"}.Register()
+
+	logger := log.LoggerConfig{}.NewLogger()
+	for i := 0; i < 3; i++ {
+		logger.Log(log.Fields{"failoverTest": i})
+	}
+
+	expected := "{\"failoverTest\":0}\n{\"failoverTest\":1}\n{\"failoverTest\":2}\n"
+	if secondary.String() != expected {
+		t.Fatalf("expected %q, but got %q", expected, secondary.String())
+	}
+
+	stats := groupStats(t, "failoverTest")
+	if stats.Written != 3 || stats.Errors != 0 {
+		t.Fatalf("expected 3 written and 0 errors, but got: %+v", stats)
+	}
+	// the third message skipped the primary
+	if m := stats.Members[0]; m.Id != "primary" || m.Errors != 2 || !m.Down {
+		t.Fatalf("expected 2 errors and down, but got: %+v", m)
+	}
+	if m := stats.Members[1]; m.Id != "secondary" || m.Written != 3 || m.Down {
+		t.Fatalf("expected 3 written and up, but got: %+v", m)
+	}
+
+	// the primary is probed and used again
+	primary.setFail(false)
+	time.Sleep(60 * time.Millisecond)
+	logger.Log(log.Fields{"failoverTest": 3})
+	logger.Log(log.Fields{"failoverTest": 4})
+
+	lines := primary.wait(t, 2)
+	if lines[0] != "{\"failoverTest\":3}\n" || lines[1] != "{\"failoverTest\":4}\n" {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+	if m := groupStats(t, "failoverTest").Members[0]; m.Written != 2 || m.Down {
+		t.Fatalf("expected 2 written and up, but got: %+v", m)
+	}
+
+	// a new group starts with new statistics
+	log.Group{
+		Id:      "failoverTest",
+		Outputs: []log.Output{{Id: "secondary", Writer: secondary}},
+		Filter:  log.FieldExist("failoverTest"),
+	}.Register()
+	if stats := groupStats(t, "failoverTest"); stats.Written != 0 || len(stats.Members) != 1 {
+		t.Fatalf("expected reset statistics, but got: %+v", stats)
+	}
+}
+
+func TestGroupRoundRobin(t *testing.T) {
+	bufs := []*bytes.Buffer{{}, {}, {}}
+	bad := &flakyWriter{fail: true}
+
+	log.Group{
+		Id:   "roundRobinTest",
+		Mode: log.GroupRoundRobin,
+		Outputs: []log.Output{
+			{Id: "a", Writer: bufs[0]},
+			{Id: "b", Writer: bufs[1]},
+			{Id: "bad", Writer: bad},
+			{Id: "c", Writer: bufs[2]},
+		},
+		Filter:    log.FieldExist("roundRobinTest"),
+		MaxErrors: 1,
+	}.Register()
+	defer log.Output{Id: "roundRobinTest"}.Register()
+
+	logger := log.LoggerConfig{}.NewLogger()
+	for i := 0; i < 6; i++ {
+		logger.Log(log.Fields{"roundRobinTest": i})
+	}
+
+	// the third message failed over to c, then bad was skipped
+	tests := []string{
+		"{\"roundRobinTest\":0}\n{\"roundRobinTest\":4}\n",
+		"{\"roundRobinTest\":1}\n{\"roundRobinTest\":5}\n",
+		"{\"roundRobinTest\":2}\n{\"roundRobinTest\":3}\n",
+	}
+	for i, expected := range tests {
+		if bufs[i].String() != expected {
+			t.Fatalf("expected %q, but got %q", expected, bufs[i].String())
+		}
+	}
+}
+
+func TestGroupMemberFilter(t *testing.T) {
+	first := &flakyWriter{fail: true}
+	second := &bytes.Buffer{}
+
+	log.Group{
+		Id: "groupFilterTest",
+		Outputs: []log.Output{
+			{Id: "first", Writer: first, Filter: log.Eq("groupFilterTest", "first")},
+			{Id: "second", Writer: second, Filter: log.Not(log.Eq("groupFilterTest", "none"))},
+		},
+		Filter:        log.FieldExist("groupFilterTest"),
+		MaxErrors:     1,
+		ProbeInterval: time.Hour,
+	}.Register()
+	defer log.Output{Id: "groupFilterTest"}.Register()
+
+	logger := log.LoggerConfig{}.NewLogger()
+	for _, v := range []string{"first", "second", "none"} {
+		logger.Log(log.Fields{"groupFilterTest": v})
+	}
+
+	// the first member failed, then it was skipped by its filter
+	expected := "{\"groupFilterTest\":\"first\"}\n{\"groupFilterTest\":\"second\"}\n"
+	if second.String() != expected {
+		t.Fatalf("expected %q, but got %q", expected, second.String())
+	}
+
+	stats := groupStats(t, "groupFilterTest")
+	if stats.Written != 2 || stats.Filtered != 1 || stats.Errors != 0 {
+		t.Fatalf("expected 2 written and 1 filtered, but got: %+v", stats)
+	}
+	if m := stats.Members[0]; m.Errors != 1 || m.Filtered != 1 || !m.Down {
+		t.Fatalf("expected 1 error, 1 filtered and down, but got: %+v", m)
+	}
+	if m := stats.Members[1]; m.Written != 2 || m.Filtered != 1 {
+		t.Fatalf("expected 2 written and 1 filtered, but got: %+v", m)
+	}
+}
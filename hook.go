@@ -0,0 +1,129 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrHookQueueFull is reported if a log message cannot be
+// queued for a Hook because its queue is full. The log
+// message is not passed to the Hook.
+var ErrHookQueueFull = errors.New("log: hook queue full, message dropped")
+
+// Hook describes a callback in the DefaultRouter that is
+// called with the log messages that match its filter, e.g.
+// to alert on errors.
+//
+// Hooks are called asynchronously from a goroutine per Hook,
+// so they cannot slow down logging. The log messages are
+// queued in a bounded queue, if it is full ErrHookQueueFull
+// is reported to the error handler registered with OnError.
+// Panics in the Func are recovered and reported as errors.
+// Errors are reported with an Output whose Id is the Id
+// of the Hook.
+//
+// The Hook receives a copy of the log message that
+// it can keep and modify.
+type Hook struct {
+	// Id identifies the hook. It can be used to update
+	// or remove the hook later.
+	Id string
+
+	// Filter specifies which messages should be passed
+	// to the hook. It is optional.
+	Filter Filter
+
+	// Func is called with the log messages.
+	Func func(fields Fields)
+
+	// Chan receives the log messages. A Hook can have
+	// both a Func and a Chan, Func is called first.
+	Chan chan<- Fields
+
+	// QueueSize is the maximum number of queued log
+	// messages. If zero, 1000 will be used.
+	QueueSize int
+}
+
+// Register registers the hook in the DefaultRouter. A hook
+// without a Func and a Chan removes the hook with the same
+// Id. The queued log messages of a replaced or removed
+// hook are still delivered.
+func (h Hook) Register() {
+	DefaultRouter.registerHook(&h)
+}
+
+type hook struct {
+	Hook
+	queue chan Fields
+}
+
+func (l *defaultRouter) registerHook(h *Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.hooks == nil {
+		l.hooks = make(map[string]*hook)
+	}
+	if old, ok := l.hooks[h.Id]; ok {
+		close(old.queue)
+		delete(l.hooks, h.Id)
+	}
+	if h.Func == nil && h.Chan == nil {
+		return
+	}
+	if h.QueueSize == 0 {
+		h.QueueSize = 1000
+	}
+
+	hk := &hook{*h, make(chan Fields, h.QueueSize)}
+	l.hooks[h.Id] = hk
+	go l.runHook(hk)
+}
+
+// hook queues the fields for the hook if they match its filter.
+func (l *defaultRouter) hook(h *hook, fields Fields) {
+	if h.Filter != nil {
+		match, err := h.Filter.Match(fields)
+		if err != nil {
+			l.reportError(err, fields, &Output{Id: h.Id}, StageFilter)
+		}
+		if !match {
+			return
+		}
+	}
+
+	select {
+	case h.queue <- fields.Clone():
+	default:
+		l.reportError(ErrHookQueueFull, fields, &Output{Id: h.Id}, StageHook)
+	}
+}
+
+func (l *defaultRouter) runHook(h *hook) {
+	for fields := range h.queue {
+		l.callHook(h, fields)
+	}
+}
+
+func (l *defaultRouter) callHook(h *hook, fields Fields) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			err := fmt.Errorf("log: hook %s panicked: %v", h.Id, r)
+			l.reportError(err, fields, &Output{Id: h.Id}, StageHook)
+		}
+	}()
+
+	if h.Func != nil {
+		h.Func(fields)
+	}
+	if h.Chan != nil {
+		h.Chan <- fields
+	}
+}
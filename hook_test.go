@@ -0,0 +1,93 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"github.com/szxp/log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHook(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan log.Fields, 10)
+	log.Hook{
+		Id:     "hookTest",
+		Filter: log.And(log.FieldExist("hookTest"), log.Eq("level", "error")),
+		Chan:   ch,
+	}.Register()
+	defer log.Hook{Id: "hookTest"}.Register()
+
+	logger := log.LoggerConfig{}.NewLogger()
+	logger.Log(log.Fields{"hookTest": 1, "level": "info"})
+	logger.Log(log.Fields{"hookTest": 2, "level": "error"})
+
+	select {
+	case fields := <-ch:
+		if fields["hookTest"] != 2 {
+			t.Fatalf("unexpected log message: %v", fields)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for the hook")
+	}
+	select {
+	case fields := <-ch:
+		t.Fatalf("unexpected log message: %v", fields)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestHookErrors(t *testing.T) {
+	errs := make(chan error, 10)
+	log.OnError(func(err error, fields log.Fields, o log.Output) {
+		if o.Id == "hookErrorTest" {
+			errs <- err
+		}
+	})
+	defer log.OnError(nil)
+
+	block := make(chan struct{})
+	log.Hook{
+		Id:     "hookErrorTest",
+		Filter: log.FieldExist("hookErrorTest"),
+		Func: func(fields log.Fields) {
+			<-block
+			panic("boom")
+		},
+		QueueSize: 1,
+	}.Register()
+	defer log.Hook{Id: "hookErrorTest"}.Register()
+
+	logger := log.LoggerConfig{}.NewLogger()
+	logger.Log(log.Fields{"hookErrorTest": 1})
+
+	// wait until the hook takes the first message off the queue
+	var err error
+	for i := 0; i < 3; i++ {
+		logger.Log(log.Fields{"hookErrorTest": 2})
+		select {
+		case err = <-errs:
+		case <-time.After(10 * time.Millisecond):
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != log.ErrHookQueueFull {
+		t.Fatalf("expected %v, but got: %v", log.ErrHookQueueFull, err)
+	}
+
+	close(block)
+	select {
+	case err = <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for the panic")
+	}
+	if !strings.Contains(err.Error(), "hook hookErrorTest panicked: boom") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
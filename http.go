@@ -0,0 +1,156 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// Payload encodings of the HTTPWriter.
+const (
+	// EncodingNDJSON sends the log messages separated by newlines.
+	EncodingNDJSON = iota
+
+	// EncodingJSONArray sends the log messages as the elements of
+	// a JSON array. The log messages must be valid JSON values.
+	EncodingJSONArray
+)
+
+// HTTPConfig can be used to create a new HTTPWriter.
+type HTTPConfig struct {
+	// URL the batches are sent to.
+	URL string
+
+	// Method of the requests. If empty, "POST" will be used.
+	Method string
+
+	// Encoding of the payload, EncodingNDJSON or EncodingJSONArray.
+	Encoding int
+
+	// Compression of the payload,
+	// CompressionNone, CompressionGzip or CompressionZlib.
+	Compression int
+
+	// Headers are added to every request.
+	Headers map[string]string
+
+	// Username and Password, if non empty, are sent
+	// using HTTP basic authentication.
+	Username string
+	Password string
+
+	// BearerToken, if non empty, is sent in the
+	// Authorization header.
+	BearerToken string
+
+	// Client sends the HTTP requests. If nil,
+	// http.DefaultClient will be used.
+	Client *http.Client
+
+	// BatchConfig configures the batching and the retries.
+	// If zero, BatchCount is 1000 and BatchBytes is 1 MB.
+	BatchConfig
+}
+
+// NewWriter creates and returns a new HTTPWriter.
+func (c HTTPConfig) NewWriter() *HTTPWriter {
+	if c.Method == "" {
+		c.Method = "POST"
+	}
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	c.BatchConfig = c.BatchConfig.withDefaults(1000, 1<<20)
+
+	w := &HTTPWriter{config: c}
+	w.batcher = newBatcher(c.BatchConfig, w.send)
+	return w
+}
+
+// HTTPWriter writes log messages to an HTTP endpoint in batches.
+//
+// Batches are sent from a background goroutine. Batches that
+// cannot be delivered are reported to the error handler
+// registered with OnError as a *BatchError.
+//
+// HTTPWriter is safe for concurrent use by multiple goroutines.
+type HTTPWriter struct {
+	config  HTTPConfig
+	batcher *batcher
+}
+
+// Write buffers the log message.
+func (w *HTTPWriter) Write(b []byte) (int, error) {
+	return w.batcher.Write(b)
+}
+
+// Flush sends the buffered log messages.
+func (w *HTTPWriter) Flush() error {
+	return w.batcher.Flush()
+}
+
+// Close flushes the buffered log messages and
+// stops the background goroutine.
+func (w *HTTPWriter) Close() error {
+	return w.batcher.Close()
+}
+
+func (w *HTTPWriter) notifyErrors(f func(err error)) {
+	w.batcher.notifyErrors(f)
+}
+
+func (w *HTTPWriter) send(lines [][]byte) error {
+	var body []byte
+	contentType := "application/x-ndjson"
+	if w.config.Encoding == EncodingJSONArray {
+		contentType = "application/json"
+		body = append(body, '[')
+		body = append(body, bytes.Join(lines, []byte{','})...)
+		body = append(body, ']')
+	} else {
+		body = bytes.Join(lines, []byte{'\n'})
+		body = append(body, '\n')
+	}
+
+	body, err := compress(body, w.config.Compression)
+	if err != nil {
+		return err
+	}
+
+	return post(w.config.Client, w.config.BatchConfig, func() (*http.Request, error) {
+		req, err := http.NewRequest(w.config.Method, w.config.URL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		if encoding := httpContentEncoding(w.config.Compression); encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		if w.config.Username != "" || w.config.Password != "" {
+			req.SetBasicAuth(w.config.Username, w.config.Password)
+		}
+		if w.config.BearerToken != "" {
+			req.Header.Set("Authorization", "Bearer "+w.config.BearerToken)
+		}
+		for k, v := range w.config.Headers {
+			req.Header.Set(k, v)
+		}
+		return req, nil
+	})
+}
+
+// httpContentEncoding returns the Content-Encoding of a payload
+// compressed with the given compression algorithm. The zlib
+// format is the "deflate" encoding of HTTP.
+func httpContentEncoding(compression int) string {
+	switch compression {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZlib:
+		return "deflate"
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"compress/gzip"
+	"errors"
+	"github.com/szxp/log"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPWriter(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		config   log.HTTPConfig
+		expected string
+	}{
+		{"ndjson", log.HTTPConfig{}, "{\"n\":1}\n{\"n\":2}\n"},
+		{"json array", log.HTTPConfig{Encoding: log.EncodingJSONArray}, `[{"n":1},{"n":2}]`},
+		{"gzip", log.HTTPConfig{Compression: log.CompressionGzip}, "{\"n\":1}\n{\"n\":2}\n"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			bodies := make(chan string, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer token1" || r.Header.Get("X-Source") != "app" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				var body io.Reader = r.Body
+				if r.Header.Get("Content-Encoding") == "gzip" {
+					body, _ = gzip.NewReader(r.Body)
+				}
+				b, _ := io.ReadAll(body)
+				bodies <- string(b)
+			}))
+			defer server.Close()
+
+			tc.config.URL = server.URL
+			tc.config.BearerToken = "token1"
+			tc.config.Headers = map[string]string{"X-Source": "app"}
+			tc.config.FlushInterval = time.Hour
+			w := tc.config.NewWriter()
+			defer w.Close()
+
+			for _, line := range []string{`{"n":1}`, `{"n":2}`} {
+				if _, err := w.Write([]byte(line + "\n")); err != nil {
+					t.Fatalf("non-nil error: %v", err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatalf("non-nil error: %v", err)
+			}
+
+			if body := <-bodies; body != tc.expected {
+				t.Fatalf("expected %q, but got: %q", tc.expected, body)
+			}
+		})
+	}
+}
+
+func TestHTTPWriterRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	w := log.HTTPConfig{URL: server.URL, BatchConfig: log.BatchConfig{FlushInterval: time.Hour, RetryBackoff: time.Millisecond}}.NewWriter()
+	defer w.Close()
+
+	start := time.Now()
+	w.Write([]byte(`{"n":1}`))
+	if err := w.Flush(); err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("expected retry after 1s, but got %v", elapsed)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("expected 2 requests, but got %d", n)
+	}
+}
+
+func TestHTTPWriterOnError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	w := log.HTTPConfig{URL: server.URL, BatchConfig: log.BatchConfig{FlushInterval: 10 * time.Millisecond}}.NewWriter()
+	defer w.Close()
+
+	errs := make(chan error, 1)
+	log.OnError(func(err error, fields log.Fields, o log.Output) {
+		if o.Id == "httpOnError" {
+			errs <- err
+		}
+	})
+	defer log.OnError(nil)
+
+	log.Output{Id: "httpOnError", Writer: w, Filter: log.FieldExist("httpOnError")}.Register()
+	defer log.Output{Id: "httpOnError"}.Register()
+
+	log.LoggerConfig{}.NewLogger().Log(log.Fields{"httpOnError": true})
+
+	var batchErr *log.BatchError
+	if err := <-errs; !errors.As(err, &batchErr) || len(batchErr.Lines) != 1 {
+		t.Fatalf("expected a batch error with 1 line, but got: %v", err)
+	}
+	if expected := `{"httpOnError":true}`; string(batchErr.Lines[0]) != expected {
+		t.Fatalf("expected %q, but got %q", expected, batchErr.Lines[0])
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JournalFormatter converts a log message into the native
+// protocol of systemd-journald.
+//
+// Every field becomes a journal field. Field names are
+// uppercased, characters other than letters, digits and
+// underscore are replaced with underscore. Nested Fields are
+// flattened with dot-separated names before sanitizing, so
+// the value at "user.id" becomes USER_ID. Keys that begin
+// with underscore will be skipped.
+//
+// The value at the key FieldMessage is written to MESSAGE,
+// the value at the key FieldLogger to SYSLOG_IDENTIFIER and
+// the syslog severity of the value at the key FieldLevel
+// to PRIORITY.
+//
+// JournalFormatter is safe for concurrent use by multiple goroutines.
+type JournalFormatter struct {
+	// TimeEncoding specifies how the times and durations
+	// of the journal fields are encoded.
+	TimeEncoding TimeEncoding
+}
+
+// Format returns the fields in the journald native protocol.
+func (f *JournalFormatter) Format(fields Fields) ([]byte, error) {
+	fields = f.TimeEncoding.Fields(fields)
+	entries := make([]journalField, 0, len(fields)+1)
+	entries = append(entries, journalField{"PRIORITY", strconv.Itoa(severity(fields[FieldLevel]))})
+
+	err := appendJournalFields(&entries, "", fields, true)
+	if err != nil {
+		return nil, err
+	}
+	sort.Stable(journalFields(entries))
+
+	buf := &bytes.Buffer{}
+	for _, e := range entries {
+		buf.WriteString(e.name)
+		if strings.IndexByte(e.value, '\n') < 0 {
+			buf.WriteByte('=')
+			buf.WriteString(e.value)
+		} else {
+			buf.WriteByte('\n')
+			binary.Write(buf, binary.LittleEndian, uint64(len(e.value)))
+			buf.WriteString(e.value)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+type journalField struct {
+	name  string
+	value string
+}
+
+type journalFields []journalField
+
+func (p journalFields) Len() int           { return len(p) }
+func (p journalFields) Less(i, j int) bool { return p[i].name < p[j].name }
+func (p journalFields) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+func appendJournalFields(entries *[]journalField, prefix string, fields Fields, top bool) error {
+	for k, v := range fields {
+		if len(k) == 0 || k[0] == '_' {
+			continue
+		}
+
+		name := prefix + k
+		if top {
+			switch k {
+			case FieldMessage:
+				name = "MESSAGE"
+			case FieldLogger:
+				name = "SYSLOG_IDENTIFIER"
+			}
+		}
+
+		v = resolve(v)
+		if fv, ok := v.(Fields); ok {
+			err := appendJournalFields(entries, name+".", fv, false)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		var value string
+		switch v := v.(type) {
+		case string:
+			value = v
+		case nil:
+			value = ""
+		case bool, int, int8, int16, int32, int64, uint, uint8, uint16,
+			uint32, uint64, float32, float64:
+			value = fmt.Sprint(v)
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			value = string(b)
+		}
+		*entries = append(*entries, journalField{journalName(name), value})
+	}
+	return nil
+}
+
+// journalName returns a valid journal field name.
+func journalName(s string) string {
+	b := []byte(strings.ToUpper(s))
+	for i, c := range b {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			b[i] = '_'
+		}
+	}
+	name := strings.TrimLeft(string(b), "_")
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "X_" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
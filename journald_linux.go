@@ -0,0 +1,202 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// DefaultJournalPath is the path of the native protocol
+// socket of systemd-journald.
+const DefaultJournalPath = "/run/systemd/journal/socket"
+
+// JournalWriter writes log messages formatted by the
+// JournalFormatter to systemd-journald.
+//
+// Every log message is sent in its own datagram. Messages
+// that are too large for a datagram are written to a sealed
+// memfd and its file descriptor is sent to journald instead.
+// If the kernel does not support memfd_create, an unlinked
+// temporary file in /dev/shm is sent.
+//
+// JournalWriter is safe for concurrent use by multiple goroutines.
+type JournalWriter struct {
+	// Path of the journald socket. If empty,
+	// DefaultJournalPath will be used.
+	Path string
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+// Write writes the log message to journald.
+func (w *JournalWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		path := w.Path
+		if path == "" {
+			path = DefaultJournalPath
+		}
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+		if err != nil {
+			return 0, err
+		}
+		w.conn = conn
+	}
+
+	// the last field is terminated by a newline,
+	// remove the one appended by the router
+	msg := b
+	if bytes.HasSuffix(msg, []byte("\n\n")) {
+		msg = msg[:len(msg)-1]
+	}
+
+	_, err := w.conn.Write(msg)
+	if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+		err = w.writeFile(msg)
+	}
+	if err != nil {
+		// reconnect on the next write
+		w.conn.Close()
+		w.conn = nil
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (w *JournalWriter) writeFile(msg []byte) error {
+	f, err := memfd(msg)
+	if err == syscall.ENOSYS {
+		f, err = tempFile(msg)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// the connection is connected, WriteMsgUnix cannot be used
+	rc, err := w.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	oob := syscall.UnixRights(int(f.Fd()))
+	var serr error
+	err = rc.Write(func(fd uintptr) bool {
+		serr = syscall.Sendmsg(int(fd), nil, oob, nil, 0)
+		return serr != syscall.EAGAIN
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
+
+// Close closes the connection to journald.
+func (w *JournalWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// Flags of memfd_create and fcntl, see memfd_create(2).
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+
+	fAddSeals   = 1024 + 9
+	fSealSeal   = 0x1
+	fSealShrink = 0x2
+	fSealGrow   = 0x4
+	fSealWrite  = 0x8
+)
+
+// memfdCreateTraps are the numbers of the memfd_create system
+// call, the syscall package defines them on a few platforms only.
+var memfdCreateTraps = map[string]uintptr{
+	"386":      356,
+	"amd64":    319,
+	"arm":      385,
+	"arm64":    279,
+	"loong64":  279,
+	"mips":     4354,
+	"mipsle":   4354,
+	"mips64":   5314,
+	"mips64le": 5314,
+	"ppc64":    360,
+	"ppc64le":  360,
+	"riscv64":  279,
+	"s390x":    350,
+}
+
+// memfd returns a sealed memfd containing msg. If memfd_create
+// is not supported, the error is syscall.ENOSYS.
+func memfd(msg []byte) (*os.File, error) {
+	trap, ok := memfdCreateTraps[runtime.GOARCH]
+	if !ok {
+		return nil, syscall.ENOSYS
+	}
+	name, err := syscall.BytePtrFromString("journal")
+	if err != nil {
+		return nil, err
+	}
+	fd, _, errno := syscall.Syscall(trap, uintptr(unsafe.Pointer(name)), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	f := os.NewFile(fd, "journal")
+
+	_, err = f.Write(msg)
+	if err == nil {
+		// journald refuses memfds that can be modified
+		_, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, fAddSeals, fSealSeal|fSealShrink|fSealGrow|fSealWrite)
+		if errno != 0 {
+			err = errno
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// tempFile returns an unlinked temporary file in /dev/shm
+// containing msg.
+func tempFile(msg []byte) (*os.File, error) {
+	dir := "/dev/shm"
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		dir = os.TempDir()
+	}
+	f, err := os.CreateTemp(dir, "journal-")
+	if err != nil {
+		return nil, err
+	}
+
+	// journald accepts unlinked files only
+	err = os.Remove(f.Name())
+	if err == nil {
+		_, err = f.Write(msg)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
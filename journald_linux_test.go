@@ -0,0 +1,90 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"bytes"
+	"github.com/szxp/log"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestJournalWriter(t *testing.T) {
+	t.Parallel()
+
+	addr := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	defer conn.Close()
+
+	w := &log.JournalWriter{Path: addr}
+	defer w.Close()
+
+	testCases := []struct {
+		name string
+		msg  []byte
+	}{
+		{"small", []byte("MESSAGE=hello\nPRIORITY=6\n")},
+		{"large", append(append([]byte("MESSAGE="), bytes.Repeat([]byte("x"), 1<<20)...), '\n')},
+	}
+
+	for _, tc := range testCases {
+		_, err = w.Write(append(tc.msg, '\n'))
+		if err != nil {
+			t.Fatalf("%s: non-nil error: %v", tc.name, err)
+		}
+
+		buf := make([]byte, 1<<16)
+		oob := make([]byte, 1024)
+		n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			t.Fatalf("%s: non-nil error: %v", tc.name, err)
+		}
+
+		actual := buf[:n]
+		if oobn > 0 {
+			actual = readPassedFile(t, oob[:oobn])
+		}
+		if !bytes.Equal(actual, tc.msg) {
+			t.Fatalf("%s: expected %d bytes, but got %d bytes", tc.name, len(tc.msg), len(actual))
+		}
+	}
+}
+
+func readPassedFile(t *testing.T, oob []byte) []byte {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+
+	f := os.NewFile(uintptr(fds[0]), "journal")
+	defer f.Close()
+
+	// a memfd must be sealed, a fallback file has no seals
+	seals, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), 1024+10, 0)
+	if errno == 0 && seals&0x8 == 0 {
+		t.Fatalf("expected a write seal, but got seals %#x", seals)
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	return b
+}
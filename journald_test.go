@@ -0,0 +1,45 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"bytes"
+	"github.com/szxp/log"
+	"testing"
+)
+
+func TestJournalFormatter(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		fields   log.Fields
+		expected string
+	}{
+		{"empty", nil, "PRIORITY=6\n"},
+		{"level", log.Fields{"level": "error"}, "LEVEL=error\nPRIORITY=3\n"},
+		{"message", log.Fields{"msg": "hello", "logger": "app1"}, "MESSAGE=hello\nPRIORITY=6\nSYSLOG_IDENTIFIER=app1\n"},
+		{"sanitize", log.Fields{"http-status": 200, "9x": true, "_skip": 1}, "HTTP_STATUS=200\nPRIORITY=6\nX_9X=true\n"},
+		{"nested", log.Fields{"user": log.Fields{"id": 1, "name": "admin"}}, "PRIORITY=6\nUSER_ID=1\nUSER_NAME=admin\n"},
+		{"array", log.Fields{"tags": []string{"a", "b"}}, "PRIORITY=6\nTAGS=[\"a\",\"b\"]\n"},
+		{"multiline", log.Fields{"msg": "a\nb"}, "MESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\nPRIORITY=6\n"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			f := log.JournalFormatter{}
+			b, err := f.Format(tc.fields)
+			if err != nil {
+				t.Fatalf("non-nil error: %v", err)
+			}
+
+			if !bytes.Equal(b, []byte(tc.expected)) {
+				t.Fatalf("expected %q, but got: %q", tc.expected, string(b))
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"sync"
+)
+
+// Lazy returns a field value that is computed by f when it is
+// needed for the first time, e.g. an expensive debug payload.
+// The value is cached for the subsequent outputs and formatters.
+//
+// The formatters evaluate lazy values, so a lazy value is not
+// evaluated if the log message does not match the filter of any
+// output. Filters that look at the path of a lazy value, such as
+// Eq, evaluate it as well.
+func Lazy(f func() interface{}) *LazyValue {
+	return &LazyValue{f: f}
+}
+
+// LazyValue is a field value computed at most once.
+// It is safe for concurrent use by multiple goroutines.
+type LazyValue struct {
+	once sync.Once
+	f    func() interface{}
+	v    interface{}
+}
+
+// Value returns the value computed by the function of the
+// LazyValue. The function is called at most once.
+func (l *LazyValue) Value() interface{} {
+	l.once.Do(func() {
+		l.v = l.f()
+		l.f = nil
+	})
+	return l.v
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"bytes"
+	"github.com/szxp/log"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLazy(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	payload := func() interface{} {
+		atomic.AddInt32(&calls, 1)
+		return log.Fields{"size": 42}
+	}
+
+	first := &bytes.Buffer{}
+	second := &bytes.Buffer{}
+	log.Output{Id: "lazyTest1", Writer: first, Filter: log.Eq("lazyTest", "write")}.Register()
+	defer log.Output{Id: "lazyTest1"}.Register()
+	log.Output{Id: "lazyTest2", Writer: second, Filter: log.Eq("lazyTest", "write")}.Register()
+	defer log.Output{Id: "lazyTest2"}.Register()
+
+	logger := log.LoggerConfig{}.NewLogger()
+
+	// filtered out by all outputs
+	logger.Log(log.Fields{"lazyTest": "skip", "payload": log.Lazy(payload)})
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Fatalf("expected 0 calls, but got: %d", n)
+	}
+
+	logger.Log(log.Fields{"lazyTest": "write", "payload": log.Lazy(payload)})
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expected 1 call, but got: %d", n)
+	}
+
+	expected := `{"lazyTest":"write","payload":{"size":42}}` + "\n"
+	for _, buf := range []*bytes.Buffer{first, second} {
+		// the order of the keys is not specified
+		if buf.Len() != len(expected) || !bytes.Contains(buf.Bytes(), []byte(`"payload":{"size":42}`)) {
+			t.Fatalf("expected %q, but got %q", expected, buf.String())
+		}
+	}
+
+	// lazy values are visible to filters
+	match, err := log.Eq("payload.size", 42).Match(log.Fields{"payload": log.Lazy(payload)})
+	if err != nil || !match {
+		t.Fatalf("expected a match, but got: %v %v", match, err)
+	}
+}
@@ -27,6 +27,18 @@ const (
 	// FieldFile is the name of the file field.
 	FieldFile = "file"
 
+	// FieldFunc is the name of the function field.
+	FieldFunc = "func"
+
+	// FieldStack is the name of the stack trace field.
+	FieldStack = "stack"
+
+	// FieldLevel is the name of the level field.
+	FieldLevel = "level"
+
+	// FieldMessage is the name of the message field.
+	FieldMessage = "msg"
+
 	// FieldSort is the name of the field that indicates
 	// if the keys should be sorted in the JSON encoded
 	// log message.
@@ -43,6 +55,20 @@ const (
 	LongFileLine
 )
 
+// Syslog severities, see RFC 5424. The value at the key
+// FieldLevel is mapped to one of these severities by
+// the formatters that need a numeric level.
+const (
+	SeverityEmergency = iota
+	SeverityAlert
+	SeverityCritical
+	SeverityError
+	SeverityWarning
+	SeverityNotice
+	SeverityInformational
+	SeverityDebug
+)
+
 // DefaultRouter is used by those Loggers which are created
 // without a Router. It can be used simultaneously from
 // multiple goroutines.
@@ -59,24 +85,81 @@ var DefaultFormatter Formatter = &JSONFormatter{}
 // Fields object.
 type Fields map[string]interface{}
 
-// Value returns the value at the given path.
+// Value returns the value at the given path, see SplitPath.
 // The second return value indicates if the path exists.
+//
+// Values that implement FieldsMarshaler are traversed as
+// the Fields object they return, maps with string keys are
+// traversed as well. Elements of slices and arrays are
+// indexed by numeric field names. Lazy values along the
+// path are evaluated. If the path has "*" elements, the
+// first of the values returned by Values is returned.
 func (f Fields) Value(path []string) (interface{}, bool) {
-	for i, field := range path {
-		v, ok := f[field]
-		if !ok {
-			return nil, false
-		}
-		if i == len(path)-1 {
-			return v, true
+	if len(path) == 0 {
+		return nil, false
+	}
+
+	var v interface{} = f
+	for _, field := range path {
+		if field == "*" {
+			values := f.Values(path)
+			if len(values) == 0 {
+				return nil, false
+			}
+			return values[0], true
 		}
 
-		f, ok = v.(Fields)
+		var ok bool
+		v, ok = child(v, field)
 		if !ok {
 			return nil, false
 		}
 	}
-	return nil, false
+	return v, true
+}
+
+// severity returns the syslog severity (0-7) of a level
+// field value. Unknown levels are treated as informational.
+func severity(level interface{}) int {
+	switch v := level.(type) {
+	case int:
+		if v >= SeverityEmergency && v <= SeverityDebug {
+			return v
+		}
+	case string:
+		switch strings.ToLower(v) {
+		case "emerg", "emergency", "panic":
+			return SeverityEmergency
+		case "alert":
+			return SeverityAlert
+		case "crit", "critical", "fatal":
+			return SeverityCritical
+		case "err", "error":
+			return SeverityError
+		case "warn", "warning":
+			return SeverityWarning
+		case "notice":
+			return SeverityNotice
+		case "debug", "trace":
+			return SeverityDebug
+		}
+	}
+	return SeverityInformational
+}
+
+// timestamp returns the time of the log message. A time.Time
+// value or an RFC 3339 formatted string at the key FieldTime
+// is used, otherwise the current time.
+func timestamp(fields Fields) time.Time {
+	switch v := resolve(fields[FieldTime]).(type) {
+	case time.Time:
+		return v
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t
+		}
+	}
+	return time.Now()
 }
 
 // MarshalJSON marshals the fields into a JSON object.
@@ -88,6 +171,9 @@ func (f Fields) Value(path []string) (interface{}, bool) {
 //
 // Keys that begin with underscore will be skipped.
 //
+// Error values are represented by their message,
+// see ErrorMarshaler for the details.
+//
 // If the Fields object contains a "_sort" key with a true
 // bool value the keys will appear in increasing order
 // in the JSON encoded string.
@@ -116,7 +202,7 @@ func (f Fields) MarshalJSON() ([]byte, error) {
 
 	size := len(keys)
 	for i, k := range keys {
-		v := f[k]
+		v := resolve(f[k])
 		b, err := json.Marshal(k)
 		if err != nil {
 			return nil, err
@@ -158,23 +244,34 @@ type LoggerConfig struct {
 	// by specifying a custom value at that key.
 	Name string
 
-	// TimeFormat specifies the format of the timestamp.
-	// If non empty, a timestamp in local time zone
-	// according to the specified format will be
-	// added to the log message at the key FieldTime.
-	// Set UTC to true to use UTC rather than the
-	// local time zone.
+	// Time, if true, adds the time of the log message as a
+	// time.Time value in local time zone to the log message
+	// at the key FieldTime. Filters can compare it, and the
+	// formatters encode it according to their TimeEncoding.
+	// Set UTC to true to use UTC rather than the local
+	// time zone.
 	//
 	// The value at the key FieldTime can be overridden
 	// by specifying a custom value at that key.
+	Time bool
+
+	// TimeFormat specifies the format of the timestamp.
+	// If non empty, a timestamp in local time zone
+	// according to the specified format will be
+	// added to the log message at the key FieldTime
+	// as a string. It takes precedence over Time.
 	//
 	// See the standard time package for details on how
 	// to define time formats:
 	// https://golang.org/pkg/time/#pkg-constants
+	//
+	// Deprecated: Use Time and the TimeEncoding of the
+	// formatters, the formatted timestamp cannot be compared
+	// by filters nor encoded differently by the formatters.
 	TimeFormat string
 
 	// UTC configures a logger to use UTC rather than the
-	// local time zone. Assumes a non empty TimeFormat.
+	// local time zone. Assumes Time or a non empty TimeFormat.
 	UTC bool
 
 	// FileLine, if not zero, adds the file name and line
@@ -188,6 +285,30 @@ type LoggerConfig struct {
 	// by specifying a custom value at that key.
 	FileLine int
 
+	// FuncName, if true, adds the fully qualified name of the
+	// calling function to the log message at the key FieldFunc,
+	// e.g. "github.com/szxp/log_test.(*T).Method".
+	//
+	// The value at the key FieldFunc can be overridden
+	// by specifying a custom value at that key.
+	FuncName bool
+
+	// StackFilter, if not nil, adds the stack trace of the
+	// calling goroutine to the log messages that match the
+	// filter at the key FieldStack, e.g. LevelAtLeast("error").
+	// The stack trace is a []Fields, a Fields object per frame
+	// with the keys "func", "file" and "line".
+	//
+	// The value at the key FieldStack can be overridden
+	// by specifying a custom value at that key.
+	StackFilter Filter
+
+	// CallDepth is the number of additional stack frames
+	// to skip when the file, the function and the stack
+	// trace are captured. Libraries that wrap a Logger can
+	// set it to report the call site of their callers.
+	CallDepth int
+
 	// SortFields indicates if the keys in the Fields
 	// object should be sorted in increasing order
 	// when marshaling the Fields object into JSON.
@@ -200,6 +321,15 @@ type LoggerConfig struct {
 	// Writers. If not specified the default router will
 	// be used.
 	Router Router
+
+	// Processors are applied in order to the log messages
+	// after the fields above are added, before they are
+	// forwarded to the Router. If a Processor drops a log
+	// message or fails, the log message is not forwarded.
+	// The errors are reported to the error handler
+	// registered with OnError if the Router is the
+	// DefaultRouter.
+	Processors []Processor
 }
 
 // NewLogger creates and returns a new logger that forwards
@@ -231,27 +361,44 @@ func (l *logger) Log(fields Fields) {
 
 	l.addTime(fields, t)
 	l.addLogger(fields)
-	l.addFile(fields, 2)
+	l.addFile(fields, 2+l.config.CallDepth)
+	l.addFunc(fields, 2+l.config.CallDepth)
+	l.addStack(fields, 2+l.config.CallDepth)
 	l.sortFields(fields)
 
 	r := l.config.Router
 	if r == nil {
 		r = DefaultRouter
 	}
+
+	fields, ok, err := process(l.config.Processors, fields)
+	if err != nil {
+		if reporter, ok := r.(processErrorReporter); ok {
+			reporter.reportProcessError(err, fields)
+		}
+		return
+	}
+	if !ok {
+		return
+	}
 	r.Log(fields)
 }
 
 func (l *logger) addTime(fields Fields, t time.Time) {
 	// don't override the user's custom "time" field
 	_, ok := fields[FieldTime]
-	if ok || l.config.TimeFormat == "" {
+	if ok || !l.config.Time && l.config.TimeFormat == "" {
 		return
 	}
 
 	if l.config.UTC {
 		t = t.UTC()
 	}
-	fields[FieldTime] = t.Format(l.config.TimeFormat)
+	if l.config.TimeFormat != "" {
+		fields[FieldTime] = t.Format(l.config.TimeFormat)
+		return
+	}
+	fields[FieldTime] = t
 }
 
 func (l *logger) addLogger(fields Fields) {
@@ -290,6 +437,61 @@ func (l *logger) addFile(fields Fields, calldepth int) {
 	fields[FieldFile] = buf.String()
 }
 
+func (l *logger) addFunc(fields Fields, calldepth int) {
+	// don't override the user's custom "func" field
+	_, ok := fields[FieldFunc]
+	if ok || !l.config.FuncName {
+		return
+	}
+
+	name := "???"
+	pc, _, _, ok := runtime.Caller(calldepth)
+	if ok {
+		if f := runtime.FuncForPC(pc); f != nil {
+			name = f.Name()
+		}
+	}
+	fields[FieldFunc] = name
+}
+
+func (l *logger) addStack(fields Fields, calldepth int) {
+	// don't override the user's custom "stack" field
+	_, ok := fields[FieldStack]
+	if ok || l.config.StackFilter == nil {
+		return
+	}
+	match, err := l.config.StackFilter.Match(fields)
+	if err != nil || !match {
+		return
+	}
+
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(calldepth+1, pcs)
+	fields[FieldStack] = stackFrames(pcs[:n])
+}
+
+// stackFrames returns the frames of the program counters
+// returned by runtime.Callers, a Fields object per frame.
+func stackFrames(pcs []uintptr) []Fields {
+	var stack []Fields
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if frame.PC == 0 && !more {
+			break
+		}
+		stack = append(stack, Fields{
+			"func": frame.Function,
+			"file": frame.File,
+			"line": frame.Line,
+		})
+		if !more {
+			break
+		}
+	}
+	return stack
+}
+
 func (l *logger) sortFields(fields Fields) {
 	// don't override the user's custom "_sort" config
 	_, ok := fields[FieldSort]
@@ -328,6 +530,24 @@ type Output struct {
 	// Filter specifies which messages should be
 	// written to the io.Writer. It is optional.
 	Filter Filter
+
+	// Processors are applied in order to the log messages
+	// that match the Filter. If a Processor drops a log
+	// message, it is not written to the io.Writer. It is
+	// optional.
+	//
+	// The log messages are shared by the outputs, the
+	// processors must not modify the fields they receive
+	// but return a modified copy.
+	Processors []Processor
+
+	// Redactor masks the sensitive values in the log
+	// messages after the Processors, before they are
+	// passed to the Formatter. It is optional.
+	Redactor *Redactor
+
+	group *group
+	stats OutputStats
 }
 
 // Register registers the output configuration in the DefaultRouter.
@@ -338,6 +558,10 @@ func (o Output) Register() {
 type defaultRouter struct {
 	mu           sync.Mutex
 	outputs      map[string]*Output
+	deadLetter   *Output
+	dedupe       *dedupe
+	redact       *Redactor
+	hooks        map[string]*hook
 	errorHandler func(err error, fields Fields, o Output)
 }
 
@@ -360,7 +584,35 @@ func (l *defaultRouter) output(o *Output) {
 		out.Formatter = DefaultFormatter
 	}
 	out.Filter = o.Filter
+	out.Processors = o.Processors
+	out.Redactor = o.Redactor
+	if out.group != o.group {
+		// the statistics belong to another group
+		out.stats = OutputStats{}
+	}
+	out.group = o.group
 	l.outputs[out.Id] = out
+
+	l.notifyErrors(out)
+	l.notifySummaries(out)
+	if out.group != nil {
+		for _, m := range out.group.members {
+			l.notifyErrors(m)
+			l.notifySummaries(m)
+		}
+	}
+}
+
+// notifyErrors registers the router as the receiver of the
+// asynchronous errors of the writer of the output.
+func (l *defaultRouter) notifyErrors(o *Output) {
+	if n, ok := o.Writer.(errorNotifier); ok {
+		n.notifyErrors(func(err error) {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.reportError(err, nil, o, StageWrite)
+		})
+	}
 }
 
 // Log marshals the fields into a JSON object and
@@ -369,39 +621,101 @@ func (l *defaultRouter) Log(fields Fields) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	for _, o := range l.outputs {
-		if o.Writer != nil {
-			if o.Filter != nil {
-				match, err := o.Filter.Match(fields)
-				if err != nil {
-					l.reportError(err, fields, o)
-				}
-				if !match {
-					continue
-				}
-			}
+	if l.redact != nil {
+		fields = l.redact.Redact(fields)
+	}
+	if l.dedupe != nil && l.dedupe.repeated(l, fields) {
+		return
+	}
+	l.route(fields)
+}
 
-			b, err := o.Formatter.Format(fields)
+// route writes the fields to the registered Writers.
+func (l *defaultRouter) route(fields Fields) {
+	for _, o := range l.outputs {
+		if o.Writer != nil || o.group != nil {
+			_, stage, err := l.write(o, fields)
 			if err != nil {
-				l.reportError(err, fields, o)
-				continue
+				l.reportError(err, fields, o, stage)
 			}
+		}
+	}
+	for _, h := range l.hooks {
+		l.hook(h, fields)
+	}
+}
 
-			writer := &writer{out: o.Writer}
-			writer.write(b)
-			writer.write([]byte{'\n'})
-			if writer.err != nil {
-				l.reportError(writer.err, fields, o)
-				continue
-			}
+// write writes the fields to the output if they match its
+// filter, it reports whether they have been written. If an
+// error occurs the stage of the delivery in which it occurred
+// is returned as well.
+func (l *defaultRouter) write(o *Output, fields Fields) (bool, string, error) {
+	if o.Filter != nil {
+		match, err := o.Filter.Match(fields)
+		if err != nil {
+			return false, StageFilter, err
+		}
+		if !match {
+			o.stats.Filtered++
+			return false, "", nil
+		}
+	}
+	fields, ok, err := process(o.Processors, fields)
+	if err != nil {
+		return false, StageProcess, err
+	}
+	if !ok {
+		o.stats.Filtered++
+		return false, "", nil
+	}
+	if o.Redactor != nil {
+		fields = o.Redactor.Redact(fields)
+	}
+	return l.deliver(o, fields)
+}
+
+// deliver formats the fields and writes them to the output.
+func (l *defaultRouter) deliver(o *Output, fields Fields) (bool, string, error) {
+	if o.group != nil {
+		written, stage, err := l.writeGroup(o.group, fields)
+		if written {
+			o.stats.Written++
+		} else if err == nil {
+			o.stats.Filtered++
 		}
+		return written, stage, err
+	}
+
+	if o.Writer == nil {
+		// removed meanwhile
+		return false, "", nil
 	}
+
+	b, err := o.Formatter.Format(fields)
+	if err != nil {
+		return false, StageFormat, err
+	}
+
+	// a single write per message, so message oriented
+	// writers (e.g. datagram sockets) receive a whole
+	// message in one call
+	writer := &writer{out: o.Writer}
+	writer.write(append(b, '\n'))
+	if writer.err != nil {
+		return false, StageWrite, writer.err
+	}
+	o.stats.Written++
+	return true, "", nil
 }
 
 // OnError registers an error handler callback in the DefaultRouter.
 //
 // The callback will be called if an error occurs while writing
-// a log message to an io.Writer.
+// a log message to an io.Writer. Writers that write log messages
+// asynchronously in batches report their errors with nil fields.
+//
+// See DeadLetter for preserving the log messages that
+// could not be delivered.
 func OnError(f func(err error, fields Fields, o Output)) {
 	DefaultRouter.onError(f)
 }
@@ -412,10 +726,76 @@ func (l *defaultRouter) onError(f func(err error, fields Fields, o Output)) {
 	l.errorHandler = f
 }
 
-func (l *defaultRouter) reportError(err error, fields Fields, o *Output) {
-	if l.onError != nil {
+func (l *defaultRouter) reportError(err error, fields Fields, o *Output, stage string) {
+	o.stats.Errors++
+	if l.errorHandler != nil {
 		l.errorHandler(err, fields, *o)
 	}
+	if l.deadLetter != nil && o != l.deadLetter {
+		l.writeDeadLetter(err, fields, o, stage)
+	}
+}
+
+// OutputStats holds the counters of an output
+// registered in the DefaultRouter.
+type OutputStats struct {
+	// Id identifies the output configuration.
+	Id string
+
+	// Written is the number of log messages written
+	// to the output.
+	Written uint64
+
+	// Filtered is the number of log messages that
+	// did not match the filter of the output. The log
+	// messages of a Group that did not match the filters
+	// of any of its members are counted as well.
+	Filtered uint64
+
+	// Errors is the number of errors that occurred
+	// while delivering log messages to the output.
+	Errors uint64
+
+	// Down indicates if the output is a member of a
+	// Group and it is skipped because of its errors.
+	Down bool
+
+	// Members are the counters of the members
+	// if the output is a Group.
+	Members []OutputStats
+}
+
+// Stats returns the counters of the outputs registered
+// in the DefaultRouter, sorted by their Ids.
+func Stats() []OutputStats {
+	return DefaultRouter.outputStats()
+}
+
+func (l *defaultRouter) outputStats() []OutputStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := make([]OutputStats, 0, len(l.outputs))
+	for _, o := range l.outputs {
+		if o.Writer == nil && o.group == nil {
+			continue
+		}
+		s := o.stats
+		s.Id = o.Id
+		if o.group != nil {
+			s.Members = o.group.stats()
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Id < stats[j].Id })
+	return stats
+}
+
+// errorNotifier is implemented by writers that write log
+// messages asynchronously, e.g. in batches. The errors
+// they encounter are reported to the router's error handler.
+type errorNotifier interface {
+	notifyErrors(f func(err error))
 }
 
 type writer struct {
@@ -442,11 +822,15 @@ type Formatter interface {
 // JSONFormatter converts a log message into JSON encoded string.
 //
 // JSONFormatter is safe for concurrent use by multiple goroutines.
-type JSONFormatter struct{}
+type JSONFormatter struct {
+	// TimeEncoding specifies how the times and
+	// durations are encoded.
+	TimeEncoding TimeEncoding
+}
 
 // Format returns the fields as a valid JSON.
 func (f *JSONFormatter) Format(fields Fields) ([]byte, error) {
-	return json.Marshal(fields)
+	return json.Marshal(f.TimeEncoding.Fields(fields))
 }
 
 // Filter represents a filter condition.
@@ -456,47 +840,103 @@ type Filter interface {
 }
 
 // FieldExist returns a filter that checks if the given path
-// exists in the log message. Path is a dot-separated field names.
+// exists in the log message. Path is a dot-separated field names,
+// see SplitPath. A "*" element matches any element of a slice
+// or any field of a Fields object, the filter matches if the
+// path exists for any of them, see Every.
 func FieldExist(path string) Filter {
-	return &fieldExist{strings.Split(path, ".")}
+	return &fieldExist{SplitPath(path), false}
 }
 
 type fieldExist struct {
-	path []string
+	path  []string
+	every bool
 }
 
 // Match returns true if the path exists in the log message.
 // Otherwise returns false.
 func (e *fieldExist) Match(fields Fields) (bool, error) {
-	_, ok := fields.Value(e.path)
-	if !ok {
-		return false, nil
-	}
-	return true, nil
+	return matchValues(fields, e.path, e.every, func(v interface{}) bool {
+		return true
+	}), nil
 }
 
 // Eq returns a filter that checks if the value at the
 // given path is equal to the given value.
-// Path is a dot-separated field names.
+// Path is a dot-separated field names, see SplitPath.
+// A "*" element matches any element of a slice or any
+// field of a Fields object, the filter matches if the
+// value of any of them is equal, see Every.
 func Eq(path string, value interface{}) Filter {
-	return &eq{strings.Split(path, "."), value}
+	return &eq{SplitPath(path), value, false}
 }
 
 type eq struct {
 	path  []string
 	value interface{}
+	every bool
 }
 
 // Match returns true if the path exists and the value at
 // that path is equal to the value in this filter.
 func (e *eq) Match(fields Fields) (bool, error) {
-	v, ok := fields.Value(e.path)
-	if !ok {
-		return false, nil
+	return matchValues(fields, e.path, e.every, func(v interface{}) bool {
+		return e.value == v
+	}), nil
+}
+
+// Every returns a copy of the filter in which the "*" elements
+// of the paths of the FieldExist and Eq filters match if the
+// rest of the path matches for every element, rather than
+// for any element, e.g.
+//
+//	Every(Eq("items.*.status", "done"))
+//
+// matches if all items are done. There must be at least one
+// element. The filters combined with And, Or and Not are
+// copied as well.
+func Every(filter Filter) Filter {
+	switch f := filter.(type) {
+	case *fieldExist:
+		return &fieldExist{f.path, true}
+	case *eq:
+		return &eq{f.path, f.value, true}
+	case *and:
+		return &and{everyFilters(f.filters)}
+	case *or:
+		return &or{everyFilters(f.filters)}
+	case *not:
+		return &not{Every(f.filter)}
 	}
-	//fmt.Printf("%T %+v\n", e.value, e.value)
-	//fmt.Printf("%T %+v\n", v, v)
-	return e.value == v, nil
+	return filter
+}
+
+func everyFilters(filters []Filter) []Filter {
+	c := make([]Filter, len(filters))
+	for i, f := range filters {
+		c[i] = Every(f)
+	}
+	return c
+}
+
+// LevelAtLeast returns a filter that checks if the level of
+// the log message at the key FieldLevel is at least as severe
+// as the given level, e.g. "error" matches the levels "error",
+// "critical", "alert" and "emergency". Levels are mapped to the
+// syslog severities, unknown levels are treated as informational.
+func LevelAtLeast(level interface{}) Filter {
+	return &levelAtLeast{severity(level)}
+}
+
+type levelAtLeast struct {
+	severity int
+}
+
+// Match returns true if the level of the log
+// message is at least as severe as the level
+// in this filter.
+func (e *levelAtLeast) Match(fields Fields) (bool, error) {
+	return severity(fields[FieldLevel]) <= e.severity, nil
 }
 
 // And returns a composite filter consisting of multiple
@@ -73,6 +73,7 @@ func TestLogger(t *testing.T) {
 	rfc3339Re := regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}:[0-9]{2}:[0-9]{2}(Z|[+-][0-9]{2}:[0-9]{2})$`)
 	shortfileRe := regexp.MustCompile(`log_test.go:[0-9]+$`)
 	longfileRe := regexp.MustCompile(`.+(\\|/)log_test.go:[0-9]+$`)
+	funcRe := regexp.MustCompile(`^github.com/szxp/log_test.TestLogger.func[0-9]+$`)
 
 	type e struct {
 		field   string
@@ -97,6 +98,8 @@ func TestLogger(t *testing.T) {
 		{"custom logger name", log.LoggerConfig{Name: "monkey"}, log.Fields{"logger": "elephant"}, []*e{{"logger", "elephant"}}},
 		{"custom short file line", log.LoggerConfig{FileLine: log.ShortFileLine}, log.Fields{"file": "line1"}, []*e{{"file", "line1"}}},
 		{"custom long file line", log.LoggerConfig{FileLine: log.LongFileLine}, log.Fields{"file": "line2"}, []*e{{"file", "line2"}}},
+		{"func name", log.LoggerConfig{FuncName: true}, nil, []*e{{"func", funcRe}}},
+		{"custom func name", log.LoggerConfig{FuncName: true}, log.Fields{"func": "func1"}, []*e{{"func", "func1"}}},
 	}
 
 	for _, tc := range testCases {
@@ -204,6 +207,32 @@ func TestFilters(t *testing.T) {
 		{"not eq string", log.Eq("logger", "requestLogger2"), log.Fields{"logger": "requestLogger"}, false},
 		{"eq string dotpath", log.Eq("user.id", 1), log.Fields{"user": log.Fields{"id": 1}}, true},
 		{"not eq string dotpath", log.Eq("user.id", 2), log.Fields{"user": log.Fields{"id": 1}}, false},
+
+		{"level at least equal", log.LevelAtLeast("error"), log.Fields{"level": "error"}, true},
+		{"level at least higher", log.LevelAtLeast("error"), log.Fields{"level": "crit"}, true},
+		{"level at least lower", log.LevelAtLeast("error"), log.Fields{"level": "warn"}, false},
+		{"level at least missing", log.LevelAtLeast("error"), log.Fields{}, false},
+		{"level at least int", log.LevelAtLeast(log.SeverityWarning), log.Fields{"level": log.SeverityError}, true},
+
+		{"eq index", log.Eq("tags.1", "b"), log.Fields{"tags": []string{"a", "b"}}, true},
+		{"eq index out of range", log.Eq("tags.2", "b"), log.Fields{"tags": []string{"a", "b"}}, false},
+		{"eq array index", log.Eq("ids.0", 7), log.Fields{"ids": [2]int{7, 8}}, true},
+		{"eq map", log.Eq("req.headers.host", "x"), log.Fields{"req": map[string]interface{}{"headers": map[string]string{"host": "x"}}}, true},
+		{"field exist map", log.FieldExist("req.method"), log.Fields{"req": map[string]interface{}{"method": "GET"}}, true},
+		{"field not exist map", log.FieldExist("req.path"), log.Fields{"req": map[string]interface{}{"method": "GET"}}, false},
+
+		{"eq wildcard any", log.Eq("items.*.status", "failed"), log.Fields{"items": []log.Fields{{"status": "done"}, {"status": "failed"}}}, true},
+		{"not eq wildcard any", log.Eq("items.*.status", "failed"), log.Fields{"items": []log.Fields{{"status": "done"}, {"status": "done"}}}, false},
+		{"eq wildcard fields", log.Eq("user.*", 1), log.Fields{"user": log.Fields{"id": 1, "name": "x"}}, true},
+		{"field exist wildcard", log.FieldExist("items.*.error"), log.Fields{"items": []interface{}{log.Fields{}, map[string]interface{}{"error": "x"}}}, true},
+		{"field exist wildcard empty", log.FieldExist("items.*"), log.Fields{"items": []interface{}{}}, false},
+
+		{"every eq", log.Every(log.Eq("items.*.status", "done")), log.Fields{"items": []log.Fields{{"status": "done"}, {"status": "done"}}}, true},
+		{"every not eq", log.Every(log.Eq("items.*.status", "done")), log.Fields{"items": []log.Fields{{"status": "done"}, {"status": "failed"}}}, false},
+		{"every missing", log.Every(log.FieldExist("items.*.status")), log.Fields{"items": []log.Fields{{"status": "done"}, {}}}, false},
+		{"every empty", log.Every(log.FieldExist("items.*")), log.Fields{"items": []int{}}, false},
+		{"every nested", log.Every(log.Eq("a.*.b.*", 1)), log.Fields{"a": []log.Fields{{"b": []int{1, 1}}, {"b": []int{1}}}}, true},
+		{"every and", log.Every(log.And(log.Eq("a.*", 1), log.Not(log.Eq("b.*", 2)))), log.Fields{"a": []int{1}, "b": []int{2, 3}}, true},
 	}
 
 	for _, tc := range testCases {
@@ -314,7 +343,7 @@ func ExampleOnError() {
 
 func ExampleLoggerConfig() {
 	logger := log.LoggerConfig{
-		TimeFormat: time.RFC3339,      // optional, see standard time package for custom formats
+		Time:       true,              // optional, add the time, see TimeEncoding for the formats
 		Name:       "loggername",      // optional, name of the logger
 		UTC:        true,              // optional, use UTC rather than local time zone
 		FileLine:   log.ShortFileLine, // optional, include file and line number
@@ -335,7 +364,7 @@ func ExampleLoggerConfig() {
 
 func ExampleFields() {
 	logger := log.LoggerConfig{
-		TimeFormat: time.RFC3339,      // optional, see standard time package for custom formats
+		Time:       true,              // optional, add the time, see TimeEncoding for the formats
 		Name:       "loggername",      // optional, name of the logger
 		UTC:        true,              // optional, use UTC rather than local time zone
 		FileLine:   log.ShortFileLine, // optional, include file and line number
@@ -410,7 +439,7 @@ func BenchmarkLogger(b *testing.B) {
 	}.Register()
 
 	logger := log.LoggerConfig{
-		TimeFormat: time.RFC3339,
+		Time:       true,
 		Name:       "loggername",
 		UTC:        true,
 		FileLine:   log.ShortFileLine,
@@ -436,3 +465,47 @@ func BenchmarkLogger(b *testing.B) {
 
 	}
 }
+
+// wrapper is a library built on a Logger.
+type wrapper struct {
+	logger log.Logger
+}
+
+func (w *wrapper) Error(msg string) {
+	w.logger.Log(log.Fields{"level": "error", "msg": msg})
+}
+
+func TestLoggerCallDepth(t *testing.T) {
+	t.Parallel()
+
+	spy := &routerSpy{}
+	w := &wrapper{log.LoggerConfig{
+		FileLine:    log.ShortFileLine,
+		FuncName:    true,
+		StackFilter: log.LevelAtLeast("error"),
+		CallDepth:   1,
+		Router:      spy,
+	}.NewLogger()}
+	w.Error("failed")
+
+	if actual := spy.fields["func"]; actual != "github.com/szxp/log_test.TestLoggerCallDepth" {
+		t.Fatalf("expected %q, but got %v", "github.com/szxp/log_test.TestLoggerCallDepth", actual)
+	}
+	if actual := fmt.Sprint(spy.fields["file"]); !regexp.MustCompile(`^log_test.go:[0-9]+$`).MatchString(actual) {
+		t.Fatalf("expected log_test.go:line, but got %v", actual)
+	}
+
+	stack, ok := spy.fields["stack"].([]log.Fields)
+	if !ok || len(stack) < 2 {
+		t.Fatalf("expected a stack trace, but got %v", spy.fields["stack"])
+	}
+	if stack[0]["func"] != "github.com/szxp/log_test.TestLoggerCallDepth" || stack[1]["func"] != "testing.tRunner" {
+		t.Fatalf("unexpected stack trace: %v", stack)
+	}
+
+	// no stack trace for other levels
+	w.logger.Log(log.Fields{"level": "info"})
+	if _, ok := spy.fields["stack"]; ok {
+		t.Fatalf("unexpected stack trace: %v", spy.fields["stack"])
+	}
+}
@@ -0,0 +1,291 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LokiFormatter converts a log message into a Grafana Loki
+// stream with a single entry, as it appears in the JSON
+// payload of the push API.
+//
+// The stream labels are taken from the values at the paths
+// listed in Labels. These should be low-cardinality fields.
+// Label names are the paths with characters other than
+// letters, digits and underscore replaced with underscore.
+// The entry is the log message converted by the Formatter,
+// timestamped with the value at the key FieldTime.
+//
+// LokiFormatter is safe for concurrent use by multiple
+// goroutines if the Formatter associated with it is safe for
+// concurrent use by multiple goroutines.
+type LokiFormatter struct {
+	// Labels are the dot-separated paths of the fields
+	// that become stream labels. Missing fields are skipped.
+	// If nil, FieldLogger and FieldLevel will be used.
+	Labels []string
+
+	// StaticLabels are added to every stream.
+	StaticLabels map[string]string
+
+	// Formatter converts the log message into the log line.
+	// If nil, the DefaultFormatter will be used.
+	Formatter Formatter
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// Format returns the fields as a Loki stream.
+func (f *LokiFormatter) Format(fields Fields) ([]byte, error) {
+	paths := f.Labels
+	if paths == nil {
+		paths = []string{FieldLogger, FieldLevel}
+	}
+	formatter := f.Formatter
+	if formatter == nil {
+		formatter = DefaultFormatter
+	}
+
+	labels := make(map[string]string, len(paths)+len(f.StaticLabels))
+	for k, v := range f.StaticLabels {
+		labels[lokiLabelName(k)] = v
+	}
+	for _, path := range paths {
+		v, ok := fields.Value(SplitPath(path))
+		if !ok || v == nil {
+			continue
+		}
+		if _, ok := v.(Fields); ok {
+			continue
+		}
+		labels[lokiLabelName(path)] = fmt.Sprint(v)
+	}
+
+	line, err := formatter.Format(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := strconv.FormatInt(timestamp(fields).UnixNano(), 10)
+	return json.Marshal(&lokiStream{labels, [][2]string{{ts, string(line)}}})
+}
+
+// lokiLabelName returns a valid Loki label name.
+func lokiLabelName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 || b[0] >= '0' && b[0] <= '9' {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+// LokiConfig can be used to create a new LokiWriter.
+type LokiConfig struct {
+	// URL of Loki, e.g. "http://localhost:3100".
+	URL string
+
+	// TenantID, if non empty, is sent in the X-Scope-OrgID
+	// header in multi-tenant mode.
+	TenantID string
+
+	// Username and Password, if non empty, are sent
+	// using HTTP basic authentication.
+	Username string
+	Password string
+
+	// Protobuf selects the snappy compressed protobuf payload
+	// rather than the JSON payload.
+	Protobuf bool
+
+	// Compression of the JSON payload, CompressionNone,
+	// CompressionGzip or CompressionZlib.
+	Compression int
+
+	// Client sends the HTTP requests. If nil,
+	// http.DefaultClient will be used.
+	Client *http.Client
+
+	// BatchConfig configures the batching and the retries.
+	// If zero, BatchCount is 1000 and BatchBytes is 1 MB.
+	BatchConfig
+}
+
+// NewWriter creates and returns a new LokiWriter.
+func (c LokiConfig) NewWriter() *LokiWriter {
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	c.BatchConfig = c.BatchConfig.withDefaults(1000, 1<<20)
+
+	w := &LokiWriter{config: c}
+	w.batcher = newBatcher(c.BatchConfig, w.send)
+	return w
+}
+
+// LokiWriter writes log messages formatted by the LokiFormatter
+// to the push API of Grafana Loki in batches. The entries
+// of a batch are grouped into streams by their label sets.
+//
+// Batches are sent from a background goroutine. Errors that
+// occur while sending are reported to the error handler
+// registered with OnError. Batches that fail because Loki
+// is unavailable or overloaded are retried with exponential
+// backoff.
+//
+// LokiWriter is safe for concurrent use by multiple goroutines.
+type LokiWriter struct {
+	config  LokiConfig
+	batcher *batcher
+}
+
+// Write buffers the log message.
+func (w *LokiWriter) Write(b []byte) (int, error) {
+	return w.batcher.Write(b)
+}
+
+// Flush sends the buffered log messages.
+func (w *LokiWriter) Flush() error {
+	return w.batcher.Flush()
+}
+
+// Close flushes the buffered log messages and
+// stops the background goroutine.
+func (w *LokiWriter) Close() error {
+	return w.batcher.Close()
+}
+
+func (w *LokiWriter) notifyErrors(f func(err error)) {
+	w.batcher.notifyErrors(f)
+}
+
+func (w *LokiWriter) send(lines [][]byte) error {
+	streams, err := lokiStreams(lines)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	contentType := "application/json"
+	contentEncoding := ""
+	if w.config.Protobuf {
+		body = snappyEncode(lokiProtobuf(streams))
+		contentType = "application/x-protobuf"
+	} else {
+		body, err = json.Marshal(map[string][]*lokiStream{"streams": streams})
+		if err != nil {
+			return err
+		}
+		contentEncoding = httpContentEncoding(w.config.Compression)
+		body, err = compress(body, w.config.Compression)
+		if err != nil {
+			return err
+		}
+	}
+
+	url := strings.TrimSuffix(w.config.URL, "/") + "/loki/api/v1/push"
+	return post(w.config.Client, w.config.BatchConfig, func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		if contentEncoding != "" {
+			req.Header.Set("Content-Encoding", contentEncoding)
+		}
+		if w.config.TenantID != "" {
+			req.Header.Set("X-Scope-OrgID", w.config.TenantID)
+		}
+		if w.config.Username != "" || w.config.Password != "" {
+			req.SetBasicAuth(w.config.Username, w.config.Password)
+		}
+		return req, nil
+	})
+}
+
+// lokiStreams groups the entries of the lines into
+// streams by their label sets, preserving their order.
+func lokiStreams(lines [][]byte) ([]*lokiStream, error) {
+	var streams []*lokiStream
+	index := make(map[string]*lokiStream)
+	for _, line := range lines {
+		s := &lokiStream{}
+		err := json.Unmarshal(line, s)
+		if err != nil {
+			return nil, err
+		}
+
+		key := lokiLabels(s.Stream)
+		stream, ok := index[key]
+		if !ok {
+			stream = &lokiStream{Stream: s.Stream}
+			index[key] = stream
+			streams = append(streams, stream)
+		}
+		stream.Values = append(stream.Values, s.Values...)
+	}
+	return streams, nil
+}
+
+// lokiLabels returns the labels in Prometheus format,
+// e.g. {level="info", logger="app"}.
+func lokiLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(name)
+		buf.WriteByte('=')
+		buf.WriteString(strconv.Quote(labels[name]))
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+// lokiProtobuf returns the streams as a logproto.PushRequest,
+// see https://github.com/grafana/loki/blob/main/pkg/push/push.proto
+func lokiProtobuf(streams []*lokiStream) []byte {
+	var req protoBuffer
+	for _, s := range streams {
+		var stream protoBuffer
+		stream.string(1, lokiLabels(s.Stream))
+		for _, v := range s.Values {
+			ns, _ := strconv.ParseInt(v[0], 10, 64)
+
+			var ts protoBuffer
+			ts.uint64(1, uint64(ns/1e9))
+			ts.uint64(2, uint64(ns%1e9))
+
+			var entry protoBuffer
+			entry.message(1, ts)
+			entry.string(2, v[1])
+			stream.message(2, entry)
+		}
+		req.message(1, stream)
+	}
+	return req
+}
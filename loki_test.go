@@ -0,0 +1,213 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"github.com/szxp/log"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLokiFormatter(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		formatter *log.LokiFormatter
+		fields    log.Fields
+		expected  string
+	}{
+		{"default labels", &log.LokiFormatter{},
+			log.Fields{"time": "2017-03-04T10:20:30Z", "logger": "app", "level": "info", "_sort": true},
+			`{"stream":{"level":"info","logger":"app"},"values":[["1488622830000000000","{\"level\":\"info\",\"logger\":\"app\",\"time\":\"2017-03-04T10:20:30Z\"}"]]}`},
+		{"custom labels", &log.LokiFormatter{Labels: []string{"service", "user.id", "missing"}, StaticLabels: map[string]string{"job": "j1"}},
+			log.Fields{"time": "2017-03-04T10:20:30Z", "service": "s1", "user": log.Fields{"id": 1}, "_sort": true},
+			`{"stream":{"job":"j1","service":"s1","user_id":"1"},"values":[["1488622830000000000","{\"service\":\"s1\",\"time\":\"2017-03-04T10:20:30Z\",\"user\":{\"id\":1}}"]]}`},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			b, err := tc.formatter.Format(tc.fields)
+			if err != nil {
+				t.Fatalf("non-nil error: %v", err)
+			}
+
+			if string(b) != tc.expected {
+				t.Fatalf("expected %q, but got: %q", tc.expected, string(b))
+			}
+		})
+	}
+}
+
+func TestLokiWriter(t *testing.T) {
+	t.Parallel()
+
+	lines := []string{
+		`{"stream":{"level":"info"},"values":[["1","a"]]}`,
+		`{"stream":{"level":"error"},"values":[["2","b"]]}`,
+		`{"stream":{"level":"info"},"values":[["3","c"]]}`,
+	}
+
+	testCases := []struct {
+		name     string
+		config   log.LokiConfig
+		expected string
+	}{
+		{"json", log.LokiConfig{},
+			`{"streams":[{"stream":{"level":"info"},"values":[["1","a"],["3","c"]]},{"stream":{"level":"error"},"values":[["2","b"]]}]}`},
+		{"json gzip", log.LokiConfig{Compression: log.CompressionGzip},
+			`{"streams":[{"stream":{"level":"info"},"values":[["1","a"],["3","c"]]},{"stream":{"level":"error"},"values":[["2","b"]]}]}`},
+		{"json zlib", log.LokiConfig{Compression: log.CompressionZlib},
+			`{"streams":[{"stream":{"level":"info"},"values":[["1","a"],["3","c"]]},{"stream":{"level":"error"},"values":[["2","b"]]}]}`},
+		{"protobuf", log.LokiConfig{Protobuf: true},
+			"\n\x22\n\x0e{level=\"info\"}\x12\x07\n\x02\x10\x01\x12\x01a\x12\x07\n\x02\x10\x03\x12\x01c" +
+				"\n\x1a\n\x0f{level=\"error\"}\x12\x07\n\x02\x10\x02\x12\x01b"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			bodies := make(chan []byte, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/loki/api/v1/push" || r.Header.Get("X-Scope-OrgID") != "tenant1" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				var body io.Reader = r.Body
+				switch r.Header.Get("Content-Encoding") {
+				case "gzip":
+					body, _ = gzip.NewReader(r.Body)
+				case "deflate":
+					body, _ = zlib.NewReader(r.Body)
+				}
+				b, _ := io.ReadAll(body)
+				if r.Header.Get("Content-Type") == "application/x-protobuf" {
+					b, _ = snappyDecode(b)
+				}
+				w.WriteHeader(http.StatusNoContent)
+				bodies <- b
+			}))
+			defer server.Close()
+
+			tc.config.URL = server.URL
+			tc.config.TenantID = "tenant1"
+			tc.config.FlushInterval = time.Hour
+			w := tc.config.NewWriter()
+			defer w.Close()
+
+			for _, line := range lines {
+				if _, err := w.Write([]byte(line + "\n")); err != nil {
+					t.Fatalf("non-nil error: %v", err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatalf("non-nil error: %v", err)
+			}
+
+			if b := <-bodies; string(b) != tc.expected {
+				t.Fatalf("expected %q, but got: %q", tc.expected, b)
+			}
+		})
+	}
+}
+
+func TestLokiWriterSnappy(t *testing.T) {
+	t.Parallel()
+
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies <- b
+	}))
+	defer server.Close()
+
+	w := log.LokiConfig{URL: server.URL, Protobuf: true, BatchConfig: log.BatchConfig{FlushInterval: time.Hour}}.NewWriter()
+	defer w.Close()
+
+	line := `{"stream":{"level":"info"},"values":[["1","` + string(bytes.Repeat([]byte("abcdefgh"), 1000)) + `"]]}`
+	if _, err := w.Write([]byte(line)); err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+
+	b := <-bodies
+	if len(b) > 1000 {
+		t.Fatalf("expected compressed payload, but got %d bytes", len(b))
+	}
+	decoded, err := snappyDecode(b)
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	if !bytes.Contains(decoded, bytes.Repeat([]byte("abcdefgh"), 1000)) {
+		t.Fatalf("log line not found in decoded payload")
+	}
+}
+
+// snappyDecode decodes a snappy block.
+func snappyDecode(src []byte) ([]byte, error) {
+	n, i := binary.Uvarint(src)
+	if i <= 0 {
+		return nil, errors.New("invalid length")
+	}
+	dst := make([]byte, 0, n)
+	for i < len(src) {
+		tag := src[i]
+		var length, offset int
+		switch tag & 3 {
+		case 0:
+			length = int(tag >> 2)
+			i++
+			if length >= 60 {
+				size := length - 59
+				length = 0
+				for j := 0; j < size; j++ {
+					length |= int(src[i+j]) << (8 * uint(j))
+				}
+				i += size
+			}
+			length++
+			dst = append(dst, src[i:i+length]...)
+			i += length
+			continue
+		case 1:
+			length = int(tag>>2&7) + 4
+			offset = int(tag>>5)<<8 | int(src[i+1])
+			i += 2
+		case 2:
+			length = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint16(src[i+1:]))
+			i += 3
+		case 3:
+			length = int(tag>>2) + 1
+			offset = int(binary.LittleEndian.Uint32(src[i+1:]))
+			i += 5
+		}
+		if offset <= 0 || offset > len(dst) {
+			return nil, errors.New("invalid offset")
+		}
+		for j := 0; j < length; j++ {
+			dst = append(dst, dst[len(dst)-offset])
+		}
+	}
+	if uint64(len(dst)) != n {
+		return nil, errors.New("invalid length")
+	}
+	return dst, nil
+}
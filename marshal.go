@@ -0,0 +1,160 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// FieldsMarshaler is implemented by types that control their
+// representation in log messages. Values that implement it are
+// represented as the Fields object returned by MarshalLogFields,
+// so filters can look into them with dot-separated paths, e.g.
+// Eq("user.id", 1) if the value at the key "user" is a
+// FieldsMarshaler.
+type FieldsMarshaler interface {
+	// MarshalLogFields returns the representation of the value.
+	MarshalLogFields() Fields
+}
+
+// Redacted is the value of the struct fields
+// with the redact option in StructFields.
+const Redacted = "[REDACTED]"
+
+// Cycle is the value of the struct fields in StructFields
+// that point to a struct which is being converted, e.g.
+// the parent of a tree node.
+const Cycle = "[CYCLE]"
+
+// StructFields converts a struct, or a pointer to a struct,
+// into a Fields object. It can be used to implement
+// FieldsMarshaler. If v is not a struct, nil is returned.
+//
+// The exported fields of the struct are converted, their names
+// are the keys unless they are specified in the "log" struct
+// field tag. The tag can have the following options:
+//
+//	// Field appears as the key "name".
+//	Field int `log:"name"`
+//
+//	// Field is skipped if its value is the zero value.
+//	Field int `log:"name,omitempty"`
+//
+//	// Field appears with the value Redacted.
+//	Field string `log:"name,redact"`
+//
+//	// Field is skipped.
+//	Field int `log:"-"`
+//
+// Nested structs are converted into nested Fields objects, except
+// time.Time and the types that implement FieldsMarshaler, error or
+// json.Marshaler, they are kept as they are. Pointers to the
+// structs being converted appear with the value Cycle.
+func StructFields(v interface{}) Fields {
+	rv := reflect.ValueOf(v)
+	visited := make(map[structPointer]bool)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		visited[structPointer{rv.Pointer(), rv.Type()}] = true
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	return structFields(rv, visited)
+}
+
+// structPointer identifies a struct, a struct and its
+// first field have the same address.
+type structPointer struct {
+	p uintptr
+	t reflect.Type
+}
+
+// structFields converts the struct, visited holds the pointers
+// to the structs being converted.
+func structFields(rv reflect.Value, visited map[structPointer]bool) Fields {
+	t := rv.Type()
+	fields := make(Fields, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		name := sf.Name
+		var omitempty, redact bool
+		if tag, ok := sf.Tag.Lookup("log"); ok {
+			if tag == "-" {
+				continue
+			}
+			opts := strings.Split(tag, ",")
+			if opts[0] != "" {
+				name = opts[0]
+			}
+			for _, opt := range opts[1:] {
+				switch opt {
+				case "omitempty":
+					omitempty = true
+				case "redact":
+					redact = true
+				}
+			}
+		}
+
+		fv := rv.Field(i)
+		if omitempty && fv.IsZero() {
+			continue
+		}
+		if redact {
+			fields[name] = Redacted
+			continue
+		}
+		fields[name] = structValue(fv, visited)
+	}
+	return fields
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	fieldsMarshalerType = reflect.TypeOf((*FieldsMarshaler)(nil)).Elem()
+	errorType           = reflect.TypeOf((*error)(nil)).Elem()
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// structValue returns the value of a struct field,
+// nested structs are converted into Fields objects.
+func structValue(fv reflect.Value, visited map[structPointer]bool) interface{} {
+	t := fv.Type()
+	if t == timeType || t.Implements(fieldsMarshalerType) ||
+		t.Implements(errorType) || t.Implements(jsonMarshalerType) {
+		return fv.Interface()
+	}
+
+	switch fv.Kind() {
+	case reflect.Ptr:
+		if fv.IsNil() {
+			return nil
+		}
+		if fv.Elem().Kind() == reflect.Struct {
+			p := structPointer{fv.Pointer(), fv.Type()}
+			if visited[p] {
+				return Cycle
+			}
+			visited[p] = true
+			defer delete(visited, p)
+			return structValue(fv.Elem(), visited)
+		}
+	case reflect.Struct:
+		return structFields(fv, visited)
+	}
+	return fv.Interface()
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"encoding/json"
+	"github.com/szxp/log"
+	"testing"
+	"time"
+)
+
+type address struct {
+	City string `log:"city"`
+	Zip  string `log:"zip,omitempty"`
+}
+
+type user struct {
+	ID       int       `log:"id"`
+	Name     string    `log:"name"`
+	Password string    `log:"password,redact"`
+	Email    string    `log:"email,omitempty"`
+	Address  *address  `log:"address"`
+	Created  time.Time `log:"created"`
+	Internal string    `log:"-"`
+	Untagged bool
+	secret   string
+}
+
+func (u *user) MarshalLogFields() log.Fields {
+	return log.StructFields(u)
+}
+
+func TestStructFields(t *testing.T) {
+	t.Parallel()
+
+	u := &user{
+		ID:       1,
+		Name:     "joe",
+		Password: "secret",
+		Address:  &address{City: "Budapest"},
+		Created:  time.Date(2017, 3, 4, 11, 44, 17, 0, time.UTC),
+		Internal: "internal",
+		Untagged: true,
+		secret:   "secret",
+	}
+
+	b, err := json.Marshal(log.Fields{"user": u, "_sort": true})
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	expected := `{"user":{"Untagged":true,"address":{"city":"Budapest"},"created":"2017-03-04T11:44:17Z","id":1,"name":"joe","password":"[REDACTED]"}}`
+	if string(b) != expected {
+		t.Fatalf("expected %q, but got %q", expected, b)
+	}
+
+	if log.StructFields(42) != nil {
+		t.Fatalf("expected nil for a non struct")
+	}
+	if log.StructFields((*user)(nil)) != nil {
+		t.Fatalf("expected nil for a nil pointer")
+	}
+}
+
+type node struct {
+	Name string
+	Next *node
+	Prev *node
+}
+
+func TestStructFieldsCycle(t *testing.T) {
+	t.Parallel()
+
+	a := &node{Name: "a"}
+	b := &node{Name: "b", Next: a}
+	a.Next = b
+	a.Prev = b
+
+	fields := log.StructFields(a)
+	tests := []struct {
+		path     string
+		expected interface{}
+	}{
+		{"Next.Name", "b"},
+		{"Next.Next", log.Cycle},
+		// not a cycle, b is converted again
+		{"Prev.Name", "b"},
+		{"Prev.Next", log.Cycle},
+	}
+	for _, test := range tests {
+		if v, _ := fields.Value(log.SplitPath(test.path)); v != test.expected {
+			t.Fatalf("%s: expected %v, but got %v", test.path, test.expected, v)
+		}
+	}
+
+	b.Next = b
+	if v, _ := log.StructFields(b).Value(log.SplitPath("Next")); v != log.Cycle {
+		t.Fatalf("expected %v, but got %v", log.Cycle, v)
+	}
+}
+
+func TestFieldsMarshalerFilters(t *testing.T) {
+	t.Parallel()
+
+	fields := log.Fields{"user": &user{ID: 1, Address: &address{City: "Budapest"}}}
+	tests := []struct {
+		filter   log.Filter
+		expected bool
+	}{
+		{log.Eq("user.id", 1), true},
+		{log.Eq("user.id", 2), false},
+		{log.Eq("user.address.city", "Budapest"), true},
+		{log.FieldExist("user.name"), true},
+		{log.FieldExist("user.email"), false},
+	}
+	for _, test := range tests {
+		match, err := test.filter.Match(fields)
+		if err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+		if match != test.expected {
+			t.Fatalf("expected %v, but got %v", test.expected, match)
+		}
+	}
+}
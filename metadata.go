@@ -0,0 +1,98 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+)
+
+// FieldMetadata is the default name of the field that
+// holds the host and process metadata.
+const FieldMetadata = "meta"
+
+// MetadataConfig can be used to create a processor
+// that adds host and process metadata to log messages.
+type MetadataConfig struct {
+	// Key is the name of the field of the metadata.
+	// If empty, FieldMetadata will be used.
+	Key string
+
+	// Env are the names of the environment variables
+	// that are added to the metadata, e.g. POD_NAME.
+	// Variables that are not set are skipped.
+	Env []string
+}
+
+// NewProcessor creates and returns a new processor that adds
+// the metadata to the log messages as a nested Fields object,
+// unless a log message already has a field with the Key:
+//
+//	{
+//	    "hostname": "web-1",
+//	    "pid": 1234,
+//	    "exe": "server",
+//	    "go_version": "go1.21.0",
+//	    "module": "example.com/server",
+//	    "version": "v1.2.3",
+//	    "vcs_revision": "4f8c2a1...",
+//	    "vcs_time": "2017-03-04T11:44:17Z",
+//	    "vcs_modified": false,
+//	    "env": {"POD_NAME": "web-1-abcde"}
+//	}
+//
+// The metadata is computed once, fields that are
+// not available are skipped.
+func (c MetadataConfig) NewProcessor() Processor {
+	if c.Key == "" {
+		c.Key = FieldMetadata
+	}
+	return StaticFields(Fields{c.Key: metadata(c.Env)})
+}
+
+func metadata(env []string) Fields {
+	meta := Fields{
+		"pid":        os.Getpid(),
+		"go_version": runtime.Version(),
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		meta["hostname"] = hostname
+	}
+	if exe, err := os.Executable(); err == nil {
+		meta["exe"] = filepath.Base(exe)
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Path != "" {
+			meta["module"] = info.Main.Path
+		}
+		if info.Main.Version != "" {
+			meta["version"] = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				meta["vcs_revision"] = s.Value
+			case "vcs.time":
+				meta["vcs_time"] = s.Value
+			case "vcs.modified":
+				meta["vcs_modified"] = s.Value == "true"
+			}
+		}
+	}
+
+	vars := Fields{}
+	for _, name := range env {
+		if v, ok := os.LookupEnv(name); ok {
+			vars[name] = v
+		}
+	}
+	if len(vars) > 0 {
+		meta["env"] = vars
+	}
+	return meta
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"github.com/szxp/log"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	os.Setenv("LOG_METADATA_TEST", "pod-1")
+	defer os.Unsetenv("LOG_METADATA_TEST")
+
+	p := log.MetadataConfig{
+		Key: "host",
+		Env: []string{"LOG_METADATA_TEST", "LOG_METADATA_MISSING"},
+	}.NewProcessor()
+
+	fields, ok, err := p.Process(log.Fields{"msg": "hello"})
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	if !ok {
+		t.Fatalf("expected the log message to be kept")
+	}
+
+	meta, ok := fields["host"].(log.Fields)
+	if !ok {
+		t.Fatalf("expected metadata, but got: %v", fields)
+	}
+	hostname, _ := os.Hostname()
+	tests := []struct {
+		path     []string
+		expected interface{}
+	}{
+		{[]string{"pid"}, os.Getpid()},
+		{[]string{"go_version"}, runtime.Version()},
+		{[]string{"hostname"}, hostname},
+		{[]string{"env", "LOG_METADATA_TEST"}, "pod-1"},
+	}
+	for _, test := range tests {
+		v, _ := meta.Value(test.path)
+		if v != test.expected {
+			t.Fatalf("%v: expected %v, but got: %v", test.path, test.expected, v)
+		}
+	}
+	if _, ok := meta.Value([]string{"env", "LOG_METADATA_MISSING"}); ok {
+		t.Fatalf("unexpected environment variable")
+	}
+
+	// a custom value is not overridden
+	fields, _, _ = p.Process(log.Fields{"host": "custom"})
+	if fields["host"] != "custom" {
+		t.Fatalf("expected %q, but got: %v", "custom", fields["host"])
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// appendMsgpack appends the MessagePack encoding of v to b,
+// see https://github.com/msgpack/msgpack/blob/master/spec.md
+//
+// Keys of Fields that begin with underscore are skipped, keys
+// of maps are sorted. Values of other types are encoded as
+// their JSON representation would be decoded by encoding/json.
+func appendMsgpack(b []byte, v interface{}) ([]byte, error) {
+	switch v := resolve(v).(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case int:
+		return appendMsgpackInt(b, int64(v)), nil
+	case int8:
+		return appendMsgpackInt(b, int64(v)), nil
+	case int16:
+		return appendMsgpackInt(b, int64(v)), nil
+	case int32:
+		return appendMsgpackInt(b, int64(v)), nil
+	case int64:
+		return appendMsgpackInt(b, v), nil
+	case uint:
+		return appendMsgpackUint(b, uint64(v)), nil
+	case uint8:
+		return appendMsgpackUint(b, uint64(v)), nil
+	case uint16:
+		return appendMsgpackUint(b, uint64(v)), nil
+	case uint32:
+		return appendMsgpackUint(b, uint64(v)), nil
+	case uint64:
+		return appendMsgpackUint(b, v), nil
+	case float32:
+		b = append(b, 0xca)
+		return binary.BigEndian.AppendUint32(b, math.Float32bits(v)), nil
+	case float64:
+		b = append(b, 0xcb)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v)), nil
+	case string:
+		return appendMsgpackString(b, v), nil
+	case []byte:
+		return appendMsgpackBinary(b, v), nil
+	case time.Time:
+		return appendMsgpackString(b, v.Format(time.RFC3339Nano)), nil
+	case Fields:
+		m := make(map[string]interface{}, len(v))
+		for k, fv := range v {
+			if len(k) > 0 && k[0] != '_' {
+				m[k] = fv
+			}
+		}
+		return appendMsgpack(b, m)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b = appendMsgpackHeader(b, len(keys), 0x80, 0xde, 0xdf)
+		var err error
+		for _, k := range keys {
+			b = appendMsgpackString(b, k)
+			b, err = appendMsgpack(b, v[k])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case []interface{}:
+		b = appendMsgpackHeader(b, len(v), 0x90, 0xdc, 0xdd)
+		var err error
+		for _, e := range v {
+			b, err = appendMsgpack(b, e)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+
+	j, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var d interface{}
+	err = json.Unmarshal(j, &d)
+	if err != nil {
+		return nil, err
+	}
+	return appendMsgpack(b, d)
+}
+
+func appendMsgpackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return appendMsgpackUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(v))
+}
+
+func appendMsgpackUint(b []byte, v uint64) []byte {
+	switch {
+	case v < 128:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xcf), v)
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackBinary(b []byte, v []byte) []byte {
+	switch n := len(v); {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, v...)
+}
+
+// appendMsgpackHeader appends the header of a map or an array
+// with the given fix, 16-bit and 32-bit format codes.
+func appendMsgpackHeader(b []byte, n int, fix, b16, b32 byte) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, b16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, b32), uint32(n))
+}
+
+// appendMsgpackEventTime appends t as a Fluentd EventTime extension.
+func appendMsgpackEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = binary.BigEndian.AppendUint32(b, uint32(t.Unix()))
+	return binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+}
+
+type msgpackReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readMsgpackString reads a string, the fixstr, str8, str16
+// and str32 formats are supported.
+func readMsgpackString(r msgpackReader) (string, error) {
+	n, err := readMsgpackLength(r, 0xa0, 0x1f, 0xd9, 0xda, 0xdb)
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return string(b), err
+}
+
+// readMsgpackMapHeader reads the number of entries of a map.
+func readMsgpackMapHeader(r msgpackReader) (int, error) {
+	return readMsgpackLength(r, 0x80, 0x0f, 0, 0xde, 0xdf)
+}
+
+func readMsgpackLength(r msgpackReader, fix, fixMask, b8, b16, b32 byte) (int, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	size := 0
+	switch {
+	case c&^fixMask == fix:
+		return int(c & fixMask), nil
+	case b8 != 0 && c == b8:
+		size = 1
+	case c == b16:
+		size = 2
+	case c == b32:
+		size = 4
+	default:
+		return 0, fmt.Errorf("log: unexpected msgpack format: 0x%x", c)
+	}
+
+	buf := make([]byte, size)
+	_, err = io.ReadFull(r, buf)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, c := range buf {
+		n = n<<8 | int(c)
+	}
+	return n, nil
+}
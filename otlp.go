@@ -0,0 +1,542 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLPFormatter converts a log message into an OpenTelemetry
+// LogRecord, as it appears in the OTLP/JSON payload of the
+// logs exporter, wrapped in a ScopeLogs object,
+// see https://opentelemetry.io/docs/specs/otlp/
+//
+// The value at the key FieldTime is mapped to time_unix_nano, the
+// value at the key FieldLevel to severity_number and severity_text,
+// the value at the key FieldMessage to body and the value at the
+// key FieldLogger to the name of the instrumentation scope. Trace
+// and span ids given as hex strings are mapped to the trace context
+// of the record. The rest of the fields are mapped to attributes,
+// nested Fields to key-value lists. Keys that begin with underscore
+// will be skipped.
+//
+// OTLPFormatter is safe for concurrent use by multiple goroutines.
+type OTLPFormatter struct {
+	// TraceIDField is the key of the trace id.
+	// If empty, "trace_id" will be used.
+	TraceIDField string
+
+	// SpanIDField is the key of the span id.
+	// If empty, "span_id" will be used.
+	SpanIDField string
+
+	// TimeEncoding specifies how the times and durations
+	// of the attributes are encoded.
+	TimeEncoding TimeEncoding
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope        `json:"scope"`
+	LogRecords []*otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScope struct {
+	Name string `json:"name,omitempty"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano,omitempty"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano,omitempty"`
+	SeverityNumber       int            `json:"severityNumber,omitempty"`
+	SeverityText         string         `json:"severityText,omitempty"`
+	Body                 *otlpAnyValue  `json:"body,omitempty"`
+	Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+	TraceID              string         `json:"traceId,omitempty"`
+	SpanID               string         `json:"spanId,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string        `json:"key"`
+	Value *otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string        `json:"stringValue,omitempty"`
+	BoolValue   *bool          `json:"boolValue,omitempty"`
+	IntValue    *string        `json:"intValue,omitempty"`
+	DoubleValue *float64       `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpValueList `json:"arrayValue,omitempty"`
+	KvlistValue *otlpKeyValues `json:"kvlistValue,omitempty"`
+}
+
+type otlpValueList struct {
+	Values []*otlpAnyValue `json:"values"`
+}
+
+type otlpKeyValues struct {
+	Values []otlpKeyValue `json:"values"`
+}
+
+// otlpSeverities maps the syslog severities to the
+// OpenTelemetry severity numbers.
+var otlpSeverities = [...]int{
+	SeverityEmergency:     23, // FATAL3
+	SeverityAlert:         22, // FATAL2
+	SeverityCritical:      21, // FATAL
+	SeverityError:         17, // ERROR
+	SeverityWarning:       13, // WARN
+	SeverityNotice:        10, // INFO2
+	SeverityInformational: 9,  // INFO
+	SeverityDebug:         5,  // DEBUG
+}
+
+// Format returns the fields as an OTLP/JSON ScopeLogs
+// object containing a single LogRecord.
+func (f *OTLPFormatter) Format(fields Fields) ([]byte, error) {
+	traceIDField := f.TraceIDField
+	if traceIDField == "" {
+		traceIDField = "trace_id"
+	}
+	spanIDField := f.SpanIDField
+	if spanIDField == "" {
+		spanIDField = "span_id"
+	}
+
+	now := time.Now()
+	r := &otlpLogRecord{
+		TimeUnixNano:         strconv.FormatInt(timestamp(fields).UnixNano(), 10),
+		ObservedTimeUnixNano: strconv.FormatInt(now.UnixNano(), 10),
+	}
+	fields = f.TimeEncoding.Fields(fields)
+
+	if level, ok := fields[FieldLevel]; ok {
+		r.SeverityNumber = otlpSeverities[severity(level)]
+		if s, ok := level.(string); ok && strings.EqualFold(s, "trace") {
+			r.SeverityNumber = 1
+		}
+		r.SeverityText = fmt.Sprint(level)
+	}
+
+	scope := ""
+	keys := make([]string, 0, len(fields))
+	for k, v := range fields {
+		if len(k) == 0 || k[0] == '_' {
+			continue
+		}
+
+		switch k {
+		case FieldTime, FieldLevel:
+			continue
+		case FieldMessage:
+			body, err := otlpValue(v)
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+			continue
+		case FieldLogger:
+			if s, ok := v.(string); ok {
+				scope = s
+				continue
+			}
+		case traceIDField:
+			if s, ok := v.(string); ok && otlpID(s, 16) {
+				r.TraceID = strings.ToLower(s)
+				continue
+			}
+		case spanIDField:
+			if s, ok := v.(string); ok && otlpID(s, 8) {
+				r.SpanID = strings.ToLower(s)
+				continue
+			}
+		}
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, err := otlpValue(fields[k])
+		if err != nil {
+			return nil, err
+		}
+		r.Attributes = append(r.Attributes, otlpKeyValue{k, v})
+	}
+
+	return json.Marshal(&otlpScopeLogs{otlpScope{scope}, []*otlpLogRecord{r}})
+}
+
+// otlpID reports whether s is a valid non-zero hex encoded id.
+func otlpID(s string, size int) bool {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != size {
+		return false
+	}
+	for _, c := range b {
+		if c != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// otlpValue converts a field value into an AnyValue.
+func otlpValue(v interface{}) (*otlpAnyValue, error) {
+	switch v := resolve(v).(type) {
+	case nil:
+		return &otlpAnyValue{}, nil
+	case string:
+		return &otlpAnyValue{StringValue: &v}, nil
+	case bool:
+		return &otlpAnyValue{BoolValue: &v}, nil
+	case int:
+		return otlpInt(int64(v)), nil
+	case int8:
+		return otlpInt(int64(v)), nil
+	case int16:
+		return otlpInt(int64(v)), nil
+	case int32:
+		return otlpInt(int64(v)), nil
+	case int64:
+		return otlpInt(v), nil
+	case uint:
+		return otlpInt(int64(v)), nil
+	case uint8:
+		return otlpInt(int64(v)), nil
+	case uint16:
+		return otlpInt(int64(v)), nil
+	case uint32:
+		return otlpInt(int64(v)), nil
+	case uint64:
+		return otlpInt(int64(v)), nil
+	case float32:
+		d := float64(v)
+		return &otlpAnyValue{DoubleValue: &d}, nil
+	case float64:
+		return &otlpAnyValue{DoubleValue: &v}, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return otlpInt(i), nil
+		}
+		d, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return &otlpAnyValue{DoubleValue: &d}, nil
+	case time.Time:
+		s := v.Format(time.RFC3339Nano)
+		return &otlpAnyValue{StringValue: &s}, nil
+	case Fields:
+		m := make(map[string]interface{}, len(v))
+		for k, fv := range v {
+			if len(k) > 0 && k[0] != '_' {
+				m[k] = fv
+			}
+		}
+		return otlpValue(m)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		list := &otlpKeyValues{Values: []otlpKeyValue{}}
+		for _, k := range keys {
+			kv, err := otlpValue(v[k])
+			if err != nil {
+				return nil, err
+			}
+			list.Values = append(list.Values, otlpKeyValue{k, kv})
+		}
+		return &otlpAnyValue{KvlistValue: list}, nil
+	case []interface{}:
+		list := &otlpValueList{Values: []*otlpAnyValue{}}
+		for _, e := range v {
+			ev, err := otlpValue(e)
+			if err != nil {
+				return nil, err
+			}
+			list.Values = append(list.Values, ev)
+		}
+		return &otlpAnyValue{ArrayValue: list}, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var dv interface{}
+	err = d.Decode(&dv)
+	if err != nil {
+		return nil, err
+	}
+	return otlpValue(dv)
+}
+
+func otlpInt(i int64) *otlpAnyValue {
+	s := strconv.FormatInt(i, 10)
+	return &otlpAnyValue{IntValue: &s}
+}
+
+// OTLPConfig can be used to create a new OTLPWriter.
+type OTLPConfig struct {
+	// URL of the OTLP/HTTP collector, e.g. "http://localhost:4318".
+	// The log records are sent to the "/v1/logs" path.
+	URL string
+
+	// Protobuf selects the binary protobuf payload
+	// rather than the JSON payload.
+	Protobuf bool
+
+	// Compression of the payload, CompressionNone,
+	// CompressionGzip or CompressionZlib.
+	Compression int
+
+	// Headers are added to every request, e.g. authorization.
+	Headers map[string]string
+
+	// Resource describes the entity producing the log messages,
+	// e.g. Fields{"service.name": "checkout"}. Its fields become
+	// the attributes of the resource.
+	Resource Fields
+
+	// Client sends the HTTP requests. If nil,
+	// http.DefaultClient will be used.
+	Client *http.Client
+
+	// BatchConfig configures the batching and the retries.
+	// If zero, BatchCount is 512 and BatchBytes is 4 MB.
+	BatchConfig
+}
+
+// NewWriter creates and returns a new OTLPWriter.
+func (c OTLPConfig) NewWriter() *OTLPWriter {
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	c.BatchConfig = c.BatchConfig.withDefaults(512, 4<<20)
+
+	w := &OTLPWriter{config: c}
+	w.batcher = newBatcher(c.BatchConfig, w.send)
+	return w
+}
+
+// OTLPWriter writes log messages formatted by the OTLPFormatter
+// to an OpenTelemetry collector over OTLP/HTTP in batches. The
+// log records of a batch are grouped by their instrumentation
+// scopes.
+//
+// Batches are sent from a background goroutine. Errors that
+// occur while sending are reported to the error handler
+// registered with OnError. Batches that fail because the
+// collector is unavailable or overloaded are retried with
+// exponential backoff.
+//
+// OTLPWriter is safe for concurrent use by multiple goroutines.
+type OTLPWriter struct {
+	config  OTLPConfig
+	batcher *batcher
+}
+
+// Write buffers the log message.
+func (w *OTLPWriter) Write(b []byte) (int, error) {
+	return w.batcher.Write(b)
+}
+
+// Flush sends the buffered log messages.
+func (w *OTLPWriter) Flush() error {
+	return w.batcher.Flush()
+}
+
+// Close flushes the buffered log messages and
+// stops the background goroutine.
+func (w *OTLPWriter) Close() error {
+	return w.batcher.Close()
+}
+
+func (w *OTLPWriter) notifyErrors(f func(err error)) {
+	w.batcher.notifyErrors(f)
+}
+
+type otlpRequest struct {
+	ResourceLogs []*otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource     `json:"resource"`
+	ScopeLogs []*otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+func (w *OTLPWriter) send(lines [][]byte) error {
+	rl := &otlpResourceLogs{}
+	if len(w.config.Resource) > 0 {
+		v, err := otlpValue(w.config.Resource)
+		if err != nil {
+			return err
+		}
+		rl.Resource.Attributes = v.KvlistValue.Values
+	}
+
+	index := make(map[string]*otlpScopeLogs)
+	for _, line := range lines {
+		sl := &otlpScopeLogs{}
+		err := json.Unmarshal(line, sl)
+		if err != nil {
+			return err
+		}
+
+		scope, ok := index[sl.Scope.Name]
+		if !ok {
+			scope = &otlpScopeLogs{Scope: sl.Scope}
+			index[sl.Scope.Name] = scope
+			rl.ScopeLogs = append(rl.ScopeLogs, scope)
+		}
+		scope.LogRecords = append(scope.LogRecords, sl.LogRecords...)
+	}
+
+	req := &otlpRequest{[]*otlpResourceLogs{rl}}
+
+	var body []byte
+	var err error
+	contentType := "application/json"
+	if w.config.Protobuf {
+		contentType = "application/x-protobuf"
+		body = req.protobuf()
+	} else {
+		body, err = json.Marshal(req)
+		if err != nil {
+			return err
+		}
+	}
+	body, err = compress(body, w.config.Compression)
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(w.config.URL, "/") + "/v1/logs"
+	return post(w.config.Client, w.config.BatchConfig, func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		if encoding := httpContentEncoding(w.config.Compression); encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		for k, v := range w.config.Headers {
+			req.Header.Set(k, v)
+		}
+		return req, nil
+	})
+}
+
+// protobuf returns the request as an ExportLogsServiceRequest,
+// see https://github.com/open-telemetry/opentelemetry-proto
+func (r *otlpRequest) protobuf() []byte {
+	var req protoBuffer
+	for _, rl := range r.ResourceLogs {
+		var resource protoBuffer
+		for _, kv := range rl.Resource.Attributes {
+			resource.message(1, kv.protobuf())
+		}
+
+		var resourceLogs protoBuffer
+		resourceLogs.message(1, resource)
+		for _, sl := range rl.ScopeLogs {
+			var scope protoBuffer
+			scope.string(1, sl.Scope.Name)
+
+			var scopeLogs protoBuffer
+			scopeLogs.message(1, scope)
+			for _, lr := range sl.LogRecords {
+				scopeLogs.message(2, lr.protobuf())
+			}
+			resourceLogs.message(2, scopeLogs)
+		}
+		req.message(1, resourceLogs)
+	}
+	return req
+}
+
+func (r *otlpLogRecord) protobuf() protoBuffer {
+	var p protoBuffer
+	t, _ := strconv.ParseUint(r.TimeUnixNano, 10, 64)
+	p.fixed64(1, t)
+	p.uint64(2, uint64(r.SeverityNumber))
+	p.string(3, r.SeverityText)
+	if r.Body != nil {
+		p.message(5, r.Body.protobuf())
+	}
+	for _, kv := range r.Attributes {
+		p.message(6, kv.protobuf())
+	}
+	traceID, _ := hex.DecodeString(r.TraceID)
+	p.bytes(9, traceID)
+	spanID, _ := hex.DecodeString(r.SpanID)
+	p.bytes(10, spanID)
+	observed, _ := strconv.ParseUint(r.ObservedTimeUnixNano, 10, 64)
+	p.fixed64(11, observed)
+	return p
+}
+
+func (kv *otlpKeyValue) protobuf() protoBuffer {
+	var p protoBuffer
+	p.string(1, kv.Key)
+	if kv.Value != nil {
+		p.message(2, kv.Value.protobuf())
+	}
+	return p
+}
+
+func (v *otlpAnyValue) protobuf() protoBuffer {
+	var p protoBuffer
+	switch {
+	case v.StringValue != nil:
+		// written even if empty, it is a oneof field
+		p.tag(1, 2)
+		p.varint(uint64(len(*v.StringValue)))
+		p = append(p, *v.StringValue...)
+	case v.BoolValue != nil:
+		p.tag(2, 0)
+		if *v.BoolValue {
+			p.varint(1)
+		} else {
+			p.varint(0)
+		}
+	case v.IntValue != nil:
+		i, _ := strconv.ParseInt(*v.IntValue, 10, 64)
+		p.tag(3, 0)
+		p.varint(uint64(i))
+	case v.DoubleValue != nil:
+		p.double(4, *v.DoubleValue)
+	case v.ArrayValue != nil:
+		var list protoBuffer
+		for _, e := range v.ArrayValue.Values {
+			list.message(1, e.protobuf())
+		}
+		p.message(5, list)
+	case v.KvlistValue != nil:
+		var list protoBuffer
+		for _, kv := range v.KvlistValue.Values {
+			list.message(1, kv.protobuf())
+		}
+		p.message(6, list)
+	}
+	return p
+}
@@ -0,0 +1,144 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/szxp/log"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestOTLPFormatter(t *testing.T) {
+	t.Parallel()
+
+	observedRe := regexp.MustCompile(`,"observedTimeUnixNano":"[0-9]+"`)
+
+	testCases := []struct {
+		name     string
+		fields   log.Fields
+		expected string
+	}{
+		{"empty", log.Fields{"time": "2017-03-04T10:20:30Z"},
+			`{"scope":{},"logRecords":[{"timeUnixNano":"1488622830000000000"}]}`},
+		{"severity", log.Fields{"time": "2017-03-04T10:20:30Z", "level": "warn", "msg": "hello", "logger": "app"},
+			`{"scope":{"name":"app"},"logRecords":[{"timeUnixNano":"1488622830000000000","severityNumber":13,"severityText":"warn","body":{"stringValue":"hello"}}]}`},
+		{"trace context", log.Fields{"time": "2017-03-04T10:20:30Z",
+			"trace_id": "5B8EFFF798038103D269B633813FC60C", "span_id": "eee19b7ec3c1b174"},
+			`{"scope":{},"logRecords":[{"timeUnixNano":"1488622830000000000","traceId":"5b8efff798038103d269b633813fc60c","spanId":"eee19b7ec3c1b174"}]}`},
+		{"invalid trace id", log.Fields{"time": "2017-03-04T10:20:30Z", "trace_id": "xyz"},
+			`{"scope":{},"logRecords":[{"timeUnixNano":"1488622830000000000","attributes":[{"key":"trace_id","value":{"stringValue":"xyz"}}]}]}`},
+		{"attributes", log.Fields{"time": "2017-03-04T10:20:30Z", "n": 1, "f": 1.5, "ok": false, "nil": nil,
+			"tags": []string{"a"}, "user": log.Fields{"id": 7}, "_skip": 1},
+			`{"scope":{},"logRecords":[{"timeUnixNano":"1488622830000000000","attributes":[` +
+				`{"key":"f","value":{"doubleValue":1.5}},{"key":"n","value":{"intValue":"1"}},` +
+				`{"key":"nil","value":{}},{"key":"ok","value":{"boolValue":false}},` +
+				`{"key":"tags","value":{"arrayValue":{"values":[{"stringValue":"a"}]}}},` +
+				`{"key":"user","value":{"kvlistValue":{"values":[{"key":"id","value":{"intValue":"7"}}]}}}]}]}`},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			f := log.OTLPFormatter{}
+			b, err := f.Format(tc.fields)
+			if err != nil {
+				t.Fatalf("non-nil error: %v", err)
+			}
+
+			actual := observedRe.ReplaceAllString(string(b), "")
+			if actual != tc.expected {
+				t.Fatalf("expected %q, but got: %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestOTLPWriter(t *testing.T) {
+	t.Parallel()
+
+	lines := []string{
+		`{"scope":{"name":"app"},"logRecords":[{"timeUnixNano":"1","body":{"stringValue":"a"}}]}`,
+		`{"scope":{"name":"db"},"logRecords":[{"timeUnixNano":"2","severityNumber":9}]}`,
+		`{"scope":{"name":"app"},"logRecords":[{"timeUnixNano":"3","spanId":"0102030405060708"}]}`,
+	}
+
+	payload := `{"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"svc"}}]},"scopeLogs":[` +
+		`{"scope":{"name":"app"},"logRecords":[{"timeUnixNano":"1","body":{"stringValue":"a"}},{"timeUnixNano":"3","spanId":"0102030405060708"}]},` +
+		`{"scope":{"name":"db"},"logRecords":[{"timeUnixNano":"2","severityNumber":9}]}]}]}`
+
+	testCases := []struct {
+		name        string
+		protobuf    bool
+		compression int
+		expected    string
+	}{
+		{"json", false, log.CompressionNone, payload},
+		{"json gzip", false, log.CompressionGzip, payload},
+		{"json zlib", false, log.CompressionZlib, payload},
+		{"protobuf", true, log.CompressionNone,
+			"\x0a\x5c" + // resource_logs
+				"\x0a\x17\x0a\x15\x0a\x0cservice.name\x12\x05\x0a\x03svc" + // resource
+				"\x12\x2c\x0a\x05\x0a\x03app" + // scope_logs, scope
+				"\x12\x0e\x09\x01\x00\x00\x00\x00\x00\x00\x00\x2a\x03\x0a\x01a" +
+				"\x12\x13\x09\x03\x00\x00\x00\x00\x00\x00\x00\x52\x08\x01\x02\x03\x04\x05\x06\x07\x08" +
+				"\x12\x13\x0a\x04\x0a\x02db" + // scope_logs, scope
+				"\x12\x0b\x09\x02\x00\x00\x00\x00\x00\x00\x00\x10\x09"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			bodies := make(chan []byte, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/logs" || r.Header.Get("Authorization") != "Bearer token1" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				var body io.Reader = r.Body
+				switch r.Header.Get("Content-Encoding") {
+				case "gzip":
+					body, _ = gzip.NewReader(r.Body)
+				case "deflate":
+					body, _ = zlib.NewReader(r.Body)
+				}
+				b, _ := io.ReadAll(body)
+				bodies <- b
+			}))
+			defer server.Close()
+
+			w := log.OTLPConfig{
+				URL:         server.URL,
+				Protobuf:    tc.protobuf,
+				Compression: tc.compression,
+				Headers:     map[string]string{"Authorization": "Bearer token1"},
+				Resource:    log.Fields{"service.name": "svc"},
+				BatchConfig: log.BatchConfig{FlushInterval: time.Hour},
+			}.NewWriter()
+			defer w.Close()
+
+			for _, line := range lines {
+				if _, err := w.Write([]byte(line + "\n")); err != nil {
+					t.Fatalf("non-nil error: %v", err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatalf("non-nil error: %v", err)
+			}
+
+			if b := <-bodies; string(b) != tc.expected {
+				t.Fatalf("expected %q, but got: %q", tc.expected, b)
+			}
+		})
+	}
+}
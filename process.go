@@ -0,0 +1,147 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+// Processor enriches, transforms or drops a log message.
+type Processor interface {
+	// Process returns the processed fields. The second
+	// return value indicates if the log message should
+	// be kept, false drops it.
+	Process(fields Fields) (Fields, bool, error)
+}
+
+// ProcessorFunc is an adapter to allow the use of
+// ordinary functions as Processors.
+type ProcessorFunc func(fields Fields) (Fields, bool, error)
+
+// Process calls f(fields).
+func (f ProcessorFunc) Process(fields Fields) (Fields, bool, error) {
+	return f(fields)
+}
+
+// process applies the processors in order. If one of them
+// fails, the original fields are returned with the error.
+func process(processors []Processor, fields Fields) (Fields, bool, error) {
+	processed := fields
+	for _, p := range processors {
+		var ok bool
+		var err error
+		processed, ok, err = p.Process(processed)
+		if err != nil {
+			return fields, false, err
+		}
+		if !ok {
+			return fields, false, nil
+		}
+	}
+	return processed, true, nil
+}
+
+// processErrorReporter is implemented by routers that report
+// the errors of the processors of the Loggers.
+type processErrorReporter interface {
+	reportProcessError(err error, fields Fields)
+}
+
+func (l *defaultRouter) reportProcessError(err error, fields Fields) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reportError(err, fields, &Output{}, StageProcess)
+}
+
+// StaticFields returns a processor that adds the given fields
+// to the log messages. Fields already present in a log message
+// are not overridden.
+func StaticFields(static Fields) Processor {
+	return ProcessorFunc(func(fields Fields) (Fields, bool, error) {
+		c := copyFields(fields)
+		for k, v := range static {
+			if _, ok := c[k]; !ok {
+				// MarshalJSON modifies the nested
+				// Fields, they cannot be shared
+				if f, ok := v.(Fields); ok {
+					v = f.Clone()
+				}
+				c[k] = v
+			}
+		}
+		return c, true, nil
+	})
+}
+
+// Rename returns a processor that moves the value at the path
+// from to the path to, overriding the value at that path. Path
+// is a dot-separated field names. Log messages without the
+// path from are not changed.
+func Rename(from, to string) Processor {
+	fromPath := SplitPath(from)
+	toPath := SplitPath(to)
+	return ProcessorFunc(func(fields Fields) (Fields, bool, error) {
+		v, ok := fields.Value(fromPath)
+		if !ok {
+			return fields, true, nil
+		}
+		c := fields.Clone()
+		c.Delete(fromPath)
+		c.Set(toPath, v)
+		return c, true, nil
+	})
+}
+
+// Remove returns a processor that removes the values at
+// the given paths. Path is a dot-separated field names.
+func Remove(paths ...string) Processor {
+	var split [][]string
+	for _, path := range paths {
+		split = append(split, SplitPath(path))
+	}
+	return ProcessorFunc(func(fields Fields) (Fields, bool, error) {
+		var c Fields
+		for _, path := range split {
+			if _, ok := fields.Value(path); !ok {
+				continue
+			}
+			if c == nil {
+				c = fields.Clone()
+			}
+			c.Delete(path)
+		}
+		if c == nil {
+			return fields, true, nil
+		}
+		return c, true, nil
+	})
+}
+
+// MapValue returns a processor that replaces the value at the
+// path with the value returned by fn, e.g. to map level names.
+// Path is a dot-separated field names. Log messages without the
+// path are not changed.
+func MapValue(path string, fn func(v interface{}) interface{}) Processor {
+	split := SplitPath(path)
+	return ProcessorFunc(func(fields Fields) (Fields, bool, error) {
+		v, ok := fields.Value(split)
+		if !ok {
+			return fields, true, nil
+		}
+		c := fields.Clone()
+		c.Set(split, fn(v))
+		return c, true, nil
+	})
+}
+
+// Process redacts the fields.
+func (r *Redactor) Process(fields Fields) (Fields, bool, error) {
+	return r.Redact(fields), true, nil
+}
+
+// copyFields returns a shallow copy of the fields.
+func copyFields(fields Fields) Fields {
+	c := make(Fields, len(fields)+1)
+	for k, v := range fields {
+		c[k] = v
+	}
+	return c
+}
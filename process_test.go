@@ -0,0 +1,158 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/szxp/log"
+	"testing"
+)
+
+func TestProcessors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		processor log.Processor
+		fields    log.Fields
+		expected  string
+	}{
+		{
+			log.StaticFields(log.Fields{"env": "prod", "msg": "static"}),
+			log.Fields{"msg": "hello"},
+			`{"env":"prod","msg":"hello"}`,
+		},
+		{
+			log.Rename("msg", "message"),
+			log.Fields{"msg": "hello"},
+			`{"message":"hello"}`,
+		},
+		{
+			log.Rename("user.name", "user_name"),
+			log.Fields{"user": log.Fields{"name": "joe", "id": 1}},
+			`{"user":{"id":1},"user_name":"joe"}`,
+		},
+		{
+			log.Rename("id", "user.id"),
+			log.Fields{"id": 1},
+			`{"user":{"id":1}}`,
+		},
+		{
+			log.Rename("missing", "x"),
+			log.Fields{"msg": "hello"},
+			`{"msg":"hello"}`,
+		},
+		{
+			log.Remove("user.password", "token", "missing.path"),
+			log.Fields{"token": "t", "user": log.Fields{"name": "joe", "password": "p"}},
+			`{"user":{"name":"joe"}}`,
+		},
+		{
+			log.MapValue("level", func(v interface{}) interface{} {
+				if v == "warn" {
+					return "warning"
+				}
+				return v
+			}),
+			log.Fields{"level": "warn"},
+			`{"level":"warning"}`,
+		},
+	}
+
+	for _, test := range tests {
+		test.fields[log.FieldSort] = true
+		before, _ := json.Marshal(test.fields)
+
+		fields, ok, err := test.processor.Process(test.fields)
+		if err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+		if !ok {
+			t.Fatalf("expected the log message to be kept")
+		}
+		b, err := json.Marshal(fields)
+		if err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+		if string(b) != test.expected {
+			t.Fatalf("expected %q, but got %q", test.expected, b)
+		}
+
+		// the original is not modified
+		after, _ := json.Marshal(test.fields)
+		if !bytes.Equal(before, after) {
+			t.Fatalf("expected %q, but got %q", before, after)
+		}
+	}
+}
+
+type routerFunc func(fields log.Fields)
+
+func (f routerFunc) Log(fields log.Fields) {
+	f(fields)
+}
+
+func TestLoggerProcessors(t *testing.T) {
+	t.Parallel()
+
+	var logged []log.Fields
+	logger := log.LoggerConfig{
+		Router: routerFunc(func(fields log.Fields) {
+			logged = append(logged, fields)
+		}),
+		Processors: []log.Processor{
+			log.ProcessorFunc(func(fields log.Fields) (log.Fields, bool, error) {
+				return fields, fields["level"] != "debug", nil
+			}),
+			log.StaticFields(log.Fields{"app": "test"}),
+		},
+	}.NewLogger()
+
+	logger.Log(log.Fields{"level": "debug"})
+	logger.Log(log.Fields{"level": "info"})
+
+	if len(logged) != 1 || logged[0]["level"] != "info" || logged[0]["app"] != "test" {
+		t.Fatalf("unexpected log messages: %v", logged)
+	}
+}
+
+func TestOutputProcessors(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log.Output{
+		Id:     "processTest",
+		Writer: buf,
+		Filter: log.FieldExist("processTest"),
+		Processors: []log.Processor{
+			log.ProcessorFunc(func(fields log.Fields) (log.Fields, bool, error) {
+				if fields["processTest"] == "fail" {
+					return nil, false, errors.New("process failed")
+				}
+				return fields, true, nil
+			}),
+			log.Remove("secret"),
+		},
+	}.Register()
+	defer log.Output{Id: "processTest"}.Register()
+
+	var errs []error
+	log.OnError(func(err error, fields log.Fields, o log.Output) {
+		if o.Id == "processTest" {
+			errs = append(errs, err)
+		}
+	})
+	defer log.OnError(nil)
+
+	logger := log.LoggerConfig{}.NewLogger()
+	logger.Log(log.Fields{"processTest": "fail"})
+	logger.Log(log.Fields{"processTest": "ok", "secret": 1})
+
+	if expected := `{"processTest":"ok"}` + "\n"; buf.String() != expected {
+		t.Fatalf("expected %q, but got %q", expected, buf.String())
+	}
+	if len(errs) != 1 || errs[0].Error() != "process failed" {
+		t.Fatalf("expected a process error, but got: %v", errs)
+	}
+}
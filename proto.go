@@ -0,0 +1,74 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// protoBuffer encodes protocol buffers messages,
+// see https://protobuf.dev/programming-guides/encoding/
+type protoBuffer []byte
+
+func (p *protoBuffer) varint(v uint64) {
+	*p = binary.AppendUvarint(*p, v)
+}
+
+func (p *protoBuffer) tag(field int, wireType int) {
+	p.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// uint64 appends a varint field, zero values are omitted.
+func (p *protoBuffer) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, 0)
+	p.varint(v)
+}
+
+// fixed64 appends a 64-bit field, zero values are omitted.
+func (p *protoBuffer) fixed64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.tag(field, 1)
+	*p = binary.LittleEndian.AppendUint64(*p, v)
+}
+
+// double appends a double field.
+func (p *protoBuffer) double(field int, v float64) {
+	p.tag(field, 1)
+	*p = binary.LittleEndian.AppendUint64(*p, math.Float64bits(v))
+}
+
+// bytes appends a length-delimited field, empty values are omitted.
+func (p *protoBuffer) bytes(field int, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	p.tag(field, 2)
+	p.varint(uint64(len(b)))
+	*p = append(*p, b...)
+}
+
+// string appends a string field, empty values are omitted.
+func (p *protoBuffer) string(field int, s string) {
+	if len(s) == 0 {
+		return
+	}
+	p.tag(field, 2)
+	p.varint(uint64(len(s)))
+	*p = append(*p, s...)
+}
+
+// message appends an embedded message field, it is
+// appended even if the embedded message is empty.
+func (p *protoBuffer) message(field int, m protoBuffer) {
+	p.tag(field, 2)
+	p.varint(uint64(len(m)))
+	*p = append(*p, m...)
+}
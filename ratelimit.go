@@ -0,0 +1,252 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig can be used to create a new RateLimiter.
+type RateLimitConfig struct {
+	// Rate is the number of log messages per second
+	// that are matched, per key. If zero or negative, all
+	// log messages are matched.
+	Rate float64
+
+	// Burst is the number of log messages that are matched
+	// at once, before the rate applies. If zero, Rate
+	// rounded up, but at least 1 will be used.
+	Burst int
+
+	// Paths are the dot-separated paths of the fields whose
+	// values make the key of a log message, e.g. FieldLogger.
+	// If empty, all log messages have the same key.
+	Paths []string
+
+	// SummaryInterval is the time after the first suppressed
+	// log message when the summary messages are written. If
+	// zero, 1 second will be used. A negative value disables
+	// the summary messages.
+	SummaryInterval time.Duration
+}
+
+// NewFilter creates and returns a new RateLimiter.
+func (c RateLimitConfig) NewFilter() *RateLimiter {
+	if c.Burst == 0 {
+		c.Burst = int(math.Max(1, math.Ceil(c.Rate)))
+	}
+	if c.SummaryInterval == 0 {
+		c.SummaryInterval = time.Second
+	}
+
+	r := &RateLimiter{
+		config:  c,
+		buckets: make(map[string]*bucket),
+	}
+	for _, path := range c.Paths {
+		r.paths = append(r.paths, SplitPath(path))
+	}
+	return r
+}
+
+// RateLimiter is a token bucket filter. It matches at most
+// Rate log messages per second with the same key, after an
+// initial Burst. The other log messages are suppressed.
+//
+// If the RateLimiter is the Filter of an Output registered in the
+// DefaultRouter, or part of it combined with And, Or or Not,
+// a summary message is written to the Output for each key
+// after the SummaryInterval, e.g.
+//
+//	{
+//	    "level": "warning",
+//	    "msg": "suppressed 1234 messages matching key logger=db",
+//	    "key": "logger=db",
+//	    "suppressed": 1234,
+//	    "time": "2017-03-04T11:44:17.123456789Z"
+//	}
+//
+// Summary messages do not pass the Filter of the Output. They
+// are written to the Output registered last with the RateLimiter,
+// so Outputs should not share a RateLimiter, the same
+// RateLimitConfig can create one for each of them.
+//
+// RateLimiter is safe for concurrent use by multiple goroutines.
+type RateLimiter struct {
+	config RateLimitConfig
+	paths  [][]string
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	timer   *time.Timer
+	notify  func(fields Fields)
+}
+
+type bucket struct {
+	tokens     float64
+	last       time.Time
+	suppressed int
+}
+
+// maxBuckets is the number of buckets above which
+// the full buckets are deleted.
+const maxBuckets = 10000
+
+// Match returns true if the log message is within the rate limit.
+func (r *RateLimiter) Match(fields Fields) (bool, error) {
+	if r.config.Rate <= 0 {
+		return true, nil
+	}
+	key := r.key(fields)
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.buckets[key]
+	if !ok {
+		if len(r.buckets) >= maxBuckets {
+			r.prune(now)
+		}
+		b = &bucket{tokens: float64(r.config.Burst), last: now}
+		r.buckets[key] = b
+	}
+	b.refill(now, r.config)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, nil
+	}
+
+	if r.notify != nil && r.config.SummaryInterval > 0 {
+		b.suppressed++
+		if r.timer == nil {
+			r.timer = time.AfterFunc(r.config.SummaryInterval, r.summarize)
+		}
+	}
+	return false, nil
+}
+
+func (b *bucket) refill(now time.Time, c RateLimitConfig) {
+	b.tokens += now.Sub(b.last).Seconds() * c.Rate
+	if b.tokens > float64(c.Burst) {
+		b.tokens = float64(c.Burst)
+	}
+	b.last = now
+}
+
+// prune deletes the buckets that are full.
+func (r *RateLimiter) prune(now time.Time) {
+	for key, b := range r.buckets {
+		b.refill(now, r.config)
+		if b.suppressed == 0 && b.tokens >= float64(r.config.Burst) {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// key returns the key of the log message, the paths
+// and their values, e.g. "logger=db user.id=42".
+func (r *RateLimiter) key(fields Fields) string {
+	buf := &strings.Builder{}
+	for i, path := range r.paths {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		v, _ := fields.Value(path)
+		fmt.Fprintf(buf, "%s=%v", r.config.Paths[i], v)
+	}
+	return buf.String()
+}
+
+// summarize writes the summary messages of the
+// keys with suppressed log messages.
+func (r *RateLimiter) summarize() {
+	r.mu.Lock()
+	keys := make([]string, 0)
+	counts := make(map[string]int)
+	for key, b := range r.buckets {
+		if b.suppressed > 0 {
+			keys = append(keys, key)
+			counts[key] = b.suppressed
+			b.suppressed = 0
+		}
+	}
+	r.timer = nil
+	notify := r.notify
+	r.mu.Unlock()
+
+	sort.Strings(keys)
+	now := time.Now()
+	for _, key := range keys {
+		msg := fmt.Sprintf("suppressed %d messages", counts[key])
+		if key != "" {
+			msg += " matching key " + key
+		}
+		notify(Fields{
+			FieldLevel:   "warning",
+			FieldMessage: msg,
+			FieldTime:    now,
+			"key":        key,
+			"suppressed": counts[key],
+		})
+	}
+}
+
+func (r *RateLimiter) notifySummaries(f func(fields Fields)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notify = f
+}
+
+// summaryNotifier is implemented by filters that write
+// summary messages, e.g. about the suppressed log messages.
+type summaryNotifier interface {
+	notifySummaries(f func(fields Fields))
+}
+
+// notifySummaries registers the output as the receiver of
+// the summary messages of the filters of the output.
+func (l *defaultRouter) notifySummaries(o *Output) {
+	walkFilters(o.Filter, func(f Filter) {
+		n, ok := f.(summaryNotifier)
+		if !ok {
+			return
+		}
+		n.notifySummaries(func(fields Fields) {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			_, stage, err := l.deliver(o, fields)
+			if err != nil {
+				l.reportError(err, fields, o, stage)
+			}
+		})
+	})
+}
+
+// walkFilters calls fn for the filter and the
+// filters of the composite filters in it.
+func walkFilters(filter Filter, fn func(f Filter)) {
+	switch f := filter.(type) {
+	case nil:
+		return
+	case *and:
+		for _, f := range f.filters {
+			walkFilters(f, fn)
+		}
+	case *or:
+		for _, f := range f.filters {
+			walkFilters(f, fn)
+		}
+	case *not:
+		walkFilters(f.filter, fn)
+	}
+	fn(filter)
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"encoding/json"
+	"github.com/szxp/log"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+
+	limiter := log.RateLimitConfig{Rate: 10, Burst: 2}.NewFilter()
+
+	tests := []struct {
+		sleep    time.Duration
+		expected bool
+	}{
+		{0, true},
+		{0, true},
+		{0, false},
+		{110 * time.Millisecond, true},
+		{0, false},
+	}
+	for i, test := range tests {
+		time.Sleep(test.sleep)
+		match, err := limiter.Match(log.Fields{})
+		if err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+		if match != test.expected {
+			t.Fatalf("%d: expected %v, but got %v", i, test.expected, match)
+		}
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	t.Parallel()
+
+	for _, rate := range []float64{0, -1} {
+		limiter := log.RateLimitConfig{Rate: rate}.NewFilter()
+		for i := 0; i < 5; i++ {
+			match, err := limiter.Match(log.Fields{})
+			if err != nil {
+				t.Fatalf("non-nil error: %v", err)
+			}
+			if !match {
+				t.Fatalf("rate %v: expected a match", rate)
+			}
+		}
+	}
+}
+
+func TestRateLimiterSummary(t *testing.T) {
+	t.Parallel()
+
+	limiter := log.RateLimitConfig{
+		Rate:            1,
+		Burst:           2,
+		Paths:           []string{"user.id"},
+		SummaryInterval: 50 * time.Millisecond,
+	}.NewFilter()
+
+	w := &flakyWriter{}
+	log.Output{
+		Id:     "rateLimitTest",
+		Writer: w,
+		Filter: log.And(log.FieldExist("rateLimitTest"), limiter),
+	}.Register()
+	defer log.Output{Id: "rateLimitTest"}.Register()
+
+	logger := log.LoggerConfig{}.NewLogger()
+	for i := 0; i < 5; i++ {
+		logger.Log(log.Fields{"rateLimitTest": i, "user": log.Fields{"id": 1}})
+	}
+	logger.Log(log.Fields{"rateLimitTest": 5, "user": log.Fields{"id": 2}})
+
+	lines := w.wait(t, 4)
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, but got: %q", lines)
+	}
+
+	var summary struct {
+		Level      string `json:"level"`
+		Msg        string `json:"msg"`
+		Key        string `json:"key"`
+		Suppressed int    `json:"suppressed"`
+		Time       string `json:"time"`
+	}
+	err := json.Unmarshal([]byte(lines[3]), &summary)
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	if summary.Msg != "suppressed 3 messages matching key user.id=1" ||
+		summary.Key != "user.id=1" || summary.Suppressed != 3 ||
+		summary.Level != "warning" || summary.Time == "" {
+		t.Fatalf("unexpected summary: %s", lines[3])
+	}
+}
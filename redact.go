@@ -0,0 +1,203 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+)
+
+// Redaction modes.
+const (
+	// RedactReplace replaces the value with the Replacement
+	// of the rule.
+	RedactReplace = iota
+
+	// RedactHash replaces the value with the first 16 hex
+	// digits of its SHA-256 hash, so equal values can still
+	// be correlated.
+	RedactHash
+
+	// RedactTruncate keeps the first Keep characters of
+	// the value and replaces the rest with "...".
+	RedactTruncate
+)
+
+// Common patterns of sensitive values that can be
+// used in the Value of a RedactRule.
+var (
+	// RedactCreditCard matches 13-19 digit card numbers,
+	// optionally grouped by spaces or dashes.
+	RedactCreditCard = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+	// RedactJWT matches JSON Web Tokens.
+	RedactJWT = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+	// RedactEmail matches email addresses.
+	RedactEmail = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+)
+
+// RedactRule selects the values to be redacted. A value is
+// selected if it is at the Path, or its field name matches Key.
+// Matches of Value in string values are redacted, the rest of
+// the string is kept.
+type RedactRule struct {
+	// Path is a dot-separated field names, see SplitPath.
+	// Elements of slices are selected by their indexes. A "*"
+	// element matches any field name or index, a "**" element
+	// matches zero or more of them, e.g. "**.password" matches
+	// the password field at any depth.
+	Path string
+
+	// Key matches the field names at any depth.
+	Key *regexp.Regexp
+
+	// Value matches the sensitive parts of string values
+	// and error messages at any depth.
+	Value *regexp.Regexp
+
+	// Mode is RedactReplace, RedactHash or RedactTruncate.
+	Mode int
+
+	// Replacement is used by RedactReplace.
+	// If empty, "[REDACTED]" will be used.
+	Replacement string
+
+	// Keep is the number of characters kept by RedactTruncate.
+	Keep int
+}
+
+// RedactConfig can be used to create a new Redactor.
+type RedactConfig struct {
+	// Rules are applied in order.
+	Rules []RedactRule
+}
+
+// NewRedactor creates and returns a new Redactor.
+func (c RedactConfig) NewRedactor() *Redactor {
+	r := &Redactor{}
+	for _, rule := range c.Rules {
+		if rule.Replacement == "" {
+			rule.Replacement = "[REDACTED]"
+		}
+		var path []string
+		if rule.Path != "" {
+			path = SplitPath(rule.Path)
+		}
+		r.rules = append(r.rules, redactRule{rule, path})
+	}
+	return r
+}
+
+// Redactor masks sensitive values in log messages. It can
+// be registered in the DefaultRouter with Redact, or used
+// in an Output.
+//
+// Redactor is safe for concurrent use by multiple goroutines.
+type Redactor struct {
+	rules []redactRule
+}
+
+type redactRule struct {
+	RedactRule
+	path []string
+}
+
+// Redact returns a copy of the fields with the sensitive values
+// redacted. The fields are not modified.
+func (r *Redactor) Redact(fields Fields) Fields {
+	return transform(fields, nil, r.redactValue).(Fields)
+}
+
+// redact returns a copy of v with the sensitive values redacted.
+// The path is the field names and indexes leading to v.
+func (r *Redactor) redact(v interface{}, path []string) interface{} {
+	v, descend := r.redactValue(v, path)
+	if descend {
+		v = transform(v, path, r.redactValue)
+	}
+	return v
+}
+
+// redactValue returns the redacted value at the path, and
+// whether its elements have to be redacted as well.
+func (r *Redactor) redactValue(v interface{}, path []string) (interface{}, bool) {
+	if lv, ok := v.(*LazyValue); ok {
+		// redacted when the value is needed
+		return Lazy(func() interface{} { return r.redact(lv.Value(), path) }), false
+	}
+
+	// errors are redacted by their representation
+	v = resolve(v)
+	for _, rule := range r.rules {
+		if rule.Key != nil && rule.Key.MatchString(path[len(path)-1]) ||
+			rule.path != nil && matchPath(rule.path, path) {
+			return rule.mask(fmt.Sprint(v)), false
+		}
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return v, true
+	}
+	for _, rule := range r.rules {
+		if rule.Value != nil {
+			s = rule.Value.ReplaceAllStringFunc(s, rule.mask)
+		}
+	}
+	return s, false
+}
+
+func (r *redactRule) mask(s string) string {
+	switch r.Mode {
+	case RedactHash:
+		h := sha256.Sum256([]byte(s))
+		return "sha256:" + hex.EncodeToString(h[:8])
+	case RedactTruncate:
+		runes := []rune(s)
+		if len(runes) <= r.Keep {
+			return s
+		}
+		return string(runes[:r.Keep]) + "..."
+	}
+	return r.Replacement
+}
+
+// matchPath reports whether the path matches the pattern,
+// the pattern may contain "*" and "**" elements.
+func matchPath(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	switch pattern[0] {
+	case "**":
+		for i := 0; i <= len(path); i++ {
+			if matchPath(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(path) > 0 && matchPath(pattern[1:], path[1:])
+	}
+	return len(path) > 0 && pattern[0] == path[0] && matchPath(pattern[1:], path[1:])
+}
+
+// Redact registers the Redactor in the DefaultRouter. The log
+// messages are redacted before they are passed to the outputs.
+// A nil Redactor disables the redaction.
+//
+// Outputs can have their own Redactor as well.
+func Redact(r *Redactor) {
+	DefaultRouter.redactor(r)
+}
+
+func (l *defaultRouter) redactor(r *Redactor) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.redact = r
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/szxp/log"
+	"regexp"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		rules    []log.RedactRule
+		fields   log.Fields
+		expected string
+	}{
+		{
+			[]log.RedactRule{{Path: "user.password"}},
+			log.Fields{"user": log.Fields{"name": "joe", "password": "secret"}},
+			`{"user":{"name":"joe","password":"[REDACTED]"}}`,
+		},
+		{
+			[]log.RedactRule{{Path: "*.password", Replacement: "***"}},
+			log.Fields{"password": "a", "user": log.Fields{"password": "b", "x": log.Fields{"password": "c"}}},
+			`{"password":"a","user":{"password":"***","x":{"password":"c"}}}`,
+		},
+		{
+			[]log.RedactRule{{Path: "**.password"}},
+			log.Fields{"password": "a", "user": log.Fields{"x": log.Fields{"password": 1}}},
+			`{"password":"[REDACTED]","user":{"x":{"password":"[REDACTED]"}}}`,
+		},
+		{
+			[]log.RedactRule{{Key: regexp.MustCompile(`(?i)token|secret`), Mode: log.RedactHash}},
+			log.Fields{"msg": "login", "req": log.Fields{"AccessToken": "abc"}},
+			`{"msg":"login","req":{"AccessToken":"sha256:ba7816bf8f01cfea"}}`,
+		},
+		{
+			[]log.RedactRule{{Path: "card", Mode: log.RedactTruncate, Keep: 4}},
+			log.Fields{"card": "4111111111111111", "short": "411"},
+			`{"card":"4111...","short":"411"}`,
+		},
+		{
+			[]log.RedactRule{
+				{Value: log.RedactCreditCard, Replacement: "[CARD]"},
+				{Value: log.RedactEmail, Replacement: "[EMAIL]"},
+				{Value: log.RedactJWT, Replacement: "[JWT]"},
+			},
+			log.Fields{
+				"msg":  "paid with 4111 1111 1111 1111 by joe@example.com",
+				"list": []interface{}{"eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.c2ln", 42},
+			},
+			`{"list":["[JWT]",42],"msg":"paid with [CARD] by [EMAIL]"}`,
+		},
+		{
+			[]log.RedactRule{{Key: regexp.MustCompile(`^password$`)}},
+			log.Fields{"users": []log.Fields{{"name": "joe", "password": "x", "_sort": true}}},
+			`{"users":[{"name":"joe","password":"[REDACTED]"}]}`,
+		},
+		{
+			[]log.RedactRule{{Path: "users.1.password"}, {Path: "groups.*.*.token"}},
+			log.Fields{
+				"users":  []map[string]interface{}{{"password": "x"}, {"password": "y"}},
+				"groups": []interface{}{[]log.Fields{{"token": "t"}}},
+			},
+			`{"groups":[[{"token":"[REDACTED]"}]],"users":[{"password":"x"},{"password":"[REDACTED]"}]}`,
+		},
+		{
+			[]log.RedactRule{{Value: log.RedactEmail, Replacement: "[EMAIL]"}},
+			log.Fields{
+				"err":  errors.New("bad joe@example.com"),
+				"errs": []interface{}{fmt.Errorf("send: %w", errors.New("to ann@example.com"))},
+			},
+			`{"err":"bad [EMAIL]","errs":[{"causes":["to [EMAIL]"],"message":"send: to [EMAIL]"}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		r := log.RedactConfig{Rules: test.rules}.NewRedactor()
+		test.fields[log.FieldSort] = true
+		before, _ := json.Marshal(test.fields)
+
+		redacted := r.Redact(test.fields)
+		b, err := json.Marshal(redacted)
+		if err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+		if string(b) != test.expected {
+			t.Fatalf("expected %q, but got %q", test.expected, b)
+		}
+
+		// the original is not modified
+		after, _ := json.Marshal(test.fields)
+		if !bytes.Equal(before, after) {
+			t.Fatalf("expected %q, but got %q", before, after)
+		}
+	}
+}
+
+func TestRedactorOutput(t *testing.T) {
+	t.Parallel()
+
+	redacted := &bytes.Buffer{}
+	plain := &bytes.Buffer{}
+	r := log.RedactConfig{Rules: []log.RedactRule{{Path: "password"}}}.NewRedactor()
+	log.Output{Id: "redactTest", Writer: redacted, Filter: log.FieldExist("redactTest"), Redactor: r}.Register()
+	defer log.Output{Id: "redactTest"}.Register()
+	log.Output{Id: "redactTestPlain", Writer: plain, Filter: log.FieldExist("redactTest")}.Register()
+	defer log.Output{Id: "redactTestPlain"}.Register()
+
+	log.LoggerConfig{SortFields: true}.NewLogger().Log(log.Fields{"redactTest": 1, "password": "secret"})
+
+	if expected := `{"password":"[REDACTED]","redactTest":1}` + "\n"; redacted.String() != expected {
+		t.Fatalf("expected %q, but got %q", expected, redacted.String())
+	}
+	if expected := `{"password":"secret","redactTest":1}` + "\n"; plain.String() != expected {
+		t.Fatalf("expected %q, but got %q", expected, plain.String())
+	}
+}
+
+func TestRedactLazy(t *testing.T) {
+	calls := 0
+	payload := func() interface{} {
+		calls++
+		return log.Fields{"token": "secret"}
+	}
+
+	buf := &bytes.Buffer{}
+	log.Redact(log.RedactConfig{Rules: []log.RedactRule{{Path: "payload.token"}}}.NewRedactor())
+	defer log.Redact(nil)
+	log.Output{Id: "redactLazyTest", Writer: buf, Filter: log.Eq("redactLazyTest", "write")}.Register()
+	defer log.Output{Id: "redactLazyTest"}.Register()
+
+	logger := log.LoggerConfig{SortFields: true}.NewLogger()
+
+	// filtered out by all outputs
+	logger.Log(log.Fields{"redactLazyTest": "skip", "payload": log.Lazy(payload)})
+	if calls != 0 {
+		t.Fatalf("expected 0 calls, but got: %d", calls)
+	}
+
+	logger.Log(log.Fields{"redactLazyTest": "write", "payload": log.Lazy(payload)})
+	if calls != 1 {
+		t.Fatalf("expected 1 call, but got: %d", calls)
+	}
+	if expected := `{"payload":{"token":"[REDACTED]"},"redactLazyTest":"write"}` + "\n"; buf.String() != expected {
+		t.Fatalf("expected %q, but got %q", expected, buf.String())
+	}
+}
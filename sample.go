@@ -0,0 +1,135 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sample returns a filter that matches the first log messages
+// with the same key in every interval, and every thereafter-th
+// log message after that. If thereafter is zero, no more log
+// messages are matched in the interval. If interval is not
+// positive, 1 second will be used.
+//
+// The key of a log message is made of the values at the given
+// paths, e.g. FieldMessage and FieldLevel. Path is a dot-separated
+// field names. If no paths are given, all log messages have the
+// same key.
+//
+// The returned filter is safe for concurrent use by multiple
+// goroutines.
+func Sample(first, thereafter int, interval time.Duration, paths ...string) Filter {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	s := &sample{
+		first:      first,
+		thereafter: thereafter,
+		interval:   interval,
+		now:        time.Now,
+		counts:     make(map[string]int),
+	}
+	for _, path := range paths {
+		s.paths = append(s.paths, SplitPath(path))
+	}
+	return s
+}
+
+type sample struct {
+	first      int
+	thereafter int
+	interval   time.Duration
+	paths      [][]string
+	now        func() time.Time
+
+	mu     sync.Mutex
+	counts map[string]int
+	reset  time.Time
+}
+
+// Match returns true if the log message is sampled.
+func (s *sample) Match(fields Fields) (bool, error) {
+	key := sampleKey(fields, s.paths)
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !now.Before(s.reset) {
+		// a new interval, the counts of all keys start over
+		s.counts = make(map[string]int)
+		s.reset = now.Add(s.interval)
+	}
+
+	n := s.counts[key] + 1
+	s.counts[key] = n
+	if n <= s.first {
+		return true, nil
+	}
+	return s.thereafter > 0 && (n-s.first)%s.thereafter == 0, nil
+}
+
+// sampleKey returns the values at the
+// given paths as a single string.
+func sampleKey(fields Fields, paths [][]string) string {
+	if len(paths) == 1 {
+		v, _ := fields.Value(paths[0])
+		return fmt.Sprint(v)
+	}
+
+	buf := &strings.Builder{}
+	for _, path := range paths {
+		v, _ := fields.Value(path)
+		fmt.Fprint(buf, v)
+		buf.WriteByte(0)
+	}
+	return buf.String()
+}
+
+// SampleHash returns a filter that matches a rate (0-1) fraction
+// of the log messages, deterministically by the value at the
+// given path. All log messages with the same value are either
+// matched or not, e.g. all log messages of a sampled trace are
+// kept together if the path is the trace id. Log messages
+// without the path are always matched.
+//
+// Path is a dot-separated field names.
+//
+// The returned filter is safe for concurrent use by multiple
+// goroutines.
+func SampleHash(path string, rate float64) Filter {
+	return &sampleHash{SplitPath(path), rate}
+}
+
+type sampleHash struct {
+	path []string
+	rate float64
+}
+
+// Match returns true if the log message is sampled.
+func (s *sampleHash) Match(fields Fields) (bool, error) {
+	v, ok := fields.Value(s.path)
+	if !ok {
+		return true, nil
+	}
+	h := fnv.New64a()
+	fmt.Fprint(h, v)
+
+	// the high bits of FNV are poorly distributed for
+	// similar values, mix them with the MurmurHash3 finalizer
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return float64(x) < s.rate*math.MaxUint64, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"fmt"
+	"github.com/szxp/log"
+	"testing"
+	"time"
+)
+
+func TestSample(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	filter := log.Sample(2, 3, time.Second, "msg", "level")
+	log.SetSampleClock(filter, func() time.Time { return now })
+
+	matches := func(fields log.Fields, n int) string {
+		s := ""
+		for i := 0; i < n; i++ {
+			match, err := filter.Match(fields)
+			if err != nil {
+				t.Fatalf("non-nil error: %v", err)
+			}
+			if match {
+				s += "1"
+			} else {
+				s += "0"
+			}
+		}
+		return s
+	}
+
+	tests := []struct {
+		fields   log.Fields
+		expected string
+	}{
+		{log.Fields{"msg": "a", "level": "debug"}, "11001001"},
+		{log.Fields{"msg": "a", "level": "info"}, "110"},
+		{log.Fields{"msg": "b", "level": "debug"}, "11001"},
+		{log.Fields{"msg": "a", "level": "debug"}, "001"},
+	}
+	for _, test := range tests {
+		if actual := matches(test.fields, len(test.expected)); actual != test.expected {
+			t.Fatalf("%v: expected %q, but got %q", test.fields, test.expected, actual)
+		}
+	}
+
+	// the same interval
+	now = now.Add(999 * time.Millisecond)
+	if actual := matches(log.Fields{"msg": "a", "level": "debug"}, 2); actual != "00" {
+		t.Fatalf("expected %q, but got %q", "00", actual)
+	}
+
+	// a new interval
+	now = now.Add(time.Millisecond)
+	if actual := matches(log.Fields{"msg": "a", "level": "debug"}, 3); actual != "110" {
+		t.Fatalf("expected %q, but got %q", "110", actual)
+	}
+}
+
+func TestSampleZeroInterval(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	filter := log.Sample(1, 0, 0)
+	log.SetSampleClock(filter, func() time.Time { return now })
+
+	for i, expected := range []bool{true, false, false} {
+		match, err := filter.Match(log.Fields{})
+		if err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+		if match != expected {
+			t.Fatalf("%d: expected %v, but got %v", i, expected, match)
+		}
+	}
+}
+
+func TestSampleHash(t *testing.T) {
+	t.Parallel()
+
+	filter := log.SampleHash("trace.id", 0.25)
+
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		fields := log.Fields{"trace": log.Fields{"id": fmt.Sprintf("%016x", i)}}
+		match, err := filter.Match(fields)
+		if err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+		// deterministic
+		for j := 0; j < 3; j++ {
+			again, _ := filter.Match(fields)
+			if again != match {
+				t.Fatalf("inconsistent sampling of trace %d", i)
+			}
+		}
+		if match {
+			sampled++
+		}
+	}
+	if sampled < 200 || sampled > 300 {
+		t.Fatalf("expected about 250 sampled traces, but got: %d", sampled)
+	}
+
+	match, err := filter.Match(log.Fields{"msg": "no trace"})
+	if err != nil || !match {
+		t.Fatalf("expected a match, but got: %v %v", match, err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"encoding/binary"
+)
+
+// snappyEncode returns the snappy block encoding of src,
+// see https://github.com/google/snappy/blob/main/format_description.txt
+//
+// It is a simple greedy encoder, its output is larger than
+// the output of the reference implementation but it can be
+// decoded by any snappy decoder.
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(nil, uint64(len(src)))
+
+	const (
+		minMatch  = 4
+		maxOffset = 1<<16 - 1
+		tableBits = 14
+	)
+	var table [1 << tableBits]int32
+
+	hash := func(u uint32) uint32 {
+		return (u * 0x1e35a7bd) >> (32 - tableBits)
+	}
+
+	lit := 0
+	for i := 0; i+minMatch <= len(src); {
+		u := binary.LittleEndian.Uint32(src[i:])
+		h := hash(u)
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+
+		if candidate < 0 || i-candidate > maxOffset ||
+			binary.LittleEndian.Uint32(src[candidate:]) != u {
+			i++
+			continue
+		}
+
+		length := minMatch
+		for i+length < len(src) && src[candidate+length] == src[i+length] {
+			length++
+		}
+
+		dst = snappyLiteral(dst, src[lit:i])
+		dst = snappyCopy(dst, i-candidate, length)
+		i += length
+		lit = i
+	}
+	return snappyLiteral(dst, src[lit:])
+}
+
+func snappyLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+
+	n := uint32(len(lit) - 1)
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2)
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// snappyCopy appends copy elements with 2-byte offsets.
+func snappyCopy(dst []byte, offset, length int) []byte {
+	for length > 0 {
+		n := length
+		if n > 64 {
+			n = 64
+		}
+		dst = append(dst, byte(n-1)<<2|2, byte(offset), byte(offset>>8))
+		length -= n
+	}
+	return dst
+}
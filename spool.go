@@ -0,0 +1,453 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpoolConfig can be used to create a new SpoolWriter.
+type SpoolConfig struct {
+	// Dir is the directory of the segment files. It is
+	// created if it does not exist. A directory must not be
+	// used by more than one SpoolWriter at the same time.
+	Dir string
+
+	// Writer is the destination of the log messages.
+	Writer io.Writer
+
+	// SegmentBytes is the size of a segment file in bytes
+	// after which a new segment is started. If zero, 4 MB
+	// will be used.
+	SegmentBytes int64
+
+	// MaxBytes is the disk budget of the segment files in bytes.
+	// If it is exceeded the oldest segments are deleted, their
+	// undelivered log messages are lost. If zero, 1 GB will
+	// be used.
+	MaxBytes int64
+
+	// RetryInterval is the delay before a failed write to
+	// the destination is retried. If zero, 1 second will be used.
+	RetryInterval time.Duration
+
+	// Sync, if true, commits every log message to stable
+	// storage before Write returns.
+	Sync bool
+}
+
+// NewWriter creates and returns a new SpoolWriter. Log messages
+// left in the directory by a previous SpoolWriter are delivered
+// first.
+func (c SpoolConfig) NewWriter() (*SpoolWriter, error) {
+	if c.SegmentBytes == 0 {
+		c.SegmentBytes = 4 << 20
+	}
+	if c.MaxBytes == 0 {
+		c.MaxBytes = 1 << 30
+	}
+	if c.RetryInterval == 0 {
+		c.RetryInterval = time.Second
+	}
+
+	err := os.MkdirAll(c.Dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &SpoolWriter{
+		config: c,
+		sizes:  make(map[uint64]int64),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	err = w.open()
+	if err != nil {
+		return nil, err
+	}
+
+	w.wg.Add(1)
+	go w.loop()
+	return w, nil
+}
+
+// SpoolWriter is a write-ahead buffer in front of a destination
+// writer. Log messages are appended to segment files on disk and
+// written to the destination in order from a background goroutine.
+// If the destination fails the log message is retried until it
+// succeeds, meanwhile new log messages are kept on disk.
+//
+// The position of the last delivered log message is persisted,
+// so a new SpoolWriter on the same directory continues where the
+// previous one stopped, e.g. after a restart of the process. Log
+// messages may be delivered more than once after a crash.
+//
+// The destination should report failures synchronously, e.g. a
+// SyslogWriter, a GELFWriter or a net.Conn. Write errors of the
+// destination are reported to the error handler registered with
+// OnError, once per outage.
+//
+// SpoolWriter is safe for concurrent use by multiple goroutines.
+type SpoolWriter struct {
+	config SpoolConfig
+
+	mu       sync.Mutex
+	segments []uint64 // in increasing order, the last one is written
+	sizes    map[uint64]int64
+	total    int64
+	file     *os.File
+	readSeq  uint64
+	readOff  int64
+	dropped  int64
+	closed   bool
+	torn     bool // the segment ends with a partial record
+	report   func(err error)
+
+	notify chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+const (
+	spoolExt    = ".spool"
+	spoolCursor = "cursor"
+)
+
+// Write appends the log message to the current segment file.
+func (w *SpoolWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, errors.New("log: write to closed spool")
+	}
+
+	seq := w.segments[len(w.segments)-1]
+	if w.torn || w.sizes[seq] >= w.config.SegmentBytes {
+		err := w.rotate()
+		if err != nil {
+			return 0, err
+		}
+		seq = w.segments[len(w.segments)-1]
+	}
+
+	rec := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(rec, uint32(len(b)))
+	rec = append(rec, b...)
+	n, err := w.file.Write(rec)
+	if err == nil && w.config.Sync {
+		err = w.file.Sync()
+	}
+	if err != nil {
+		if n > 0 {
+			w.discard(w.sizes[seq])
+		}
+		return 0, err
+	}
+	w.sizes[seq] += int64(n)
+	w.total += int64(n)
+
+	w.evict()
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+	return len(b), nil
+}
+
+// Close stops the background goroutine and closes the current
+// segment file. Undelivered log messages are kept on disk.
+func (w *SpoolWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.saveCursor()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (w *SpoolWriter) notifyErrors(f func(err error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.report = f
+}
+
+// open loads the segments and the cursor left in the
+// directory and starts a new segment.
+func (w *SpoolWriter) open() error {
+	names, err := filepath.Glob(filepath.Join(w.config.Dir, "*"+spoolExt))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(name), spoolExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		w.segments = append(w.segments, seq)
+		w.sizes[seq] = fi.Size()
+		w.total += fi.Size()
+	}
+	sort.Slice(w.segments, func(i, j int) bool { return w.segments[i] < w.segments[j] })
+
+	b, err := os.ReadFile(filepath.Join(w.config.Dir, spoolCursor))
+	if err == nil {
+		var seq uint64
+		var off int64
+		_, err = fmt.Sscanf(string(b), "%d %d", &seq, &off)
+		if _, ok := w.sizes[seq]; ok && err == nil {
+			w.readSeq, w.readOff = seq, off
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if _, ok := w.sizes[w.readSeq]; !ok && len(w.segments) > 0 {
+		w.readSeq, w.readOff = w.segments[0], 0
+	}
+	for len(w.segments) > 0 && w.segments[0] < w.readSeq {
+		// delivered, but not deleted before a crash
+		w.remove(w.segments[0])
+	}
+
+	return w.rotate()
+}
+
+// rotate starts a new segment.
+func (w *SpoolWriter) rotate() error {
+	seq := uint64(1)
+	if len(w.segments) > 0 {
+		seq = w.segments[len(w.segments)-1] + 1
+	}
+
+	f, err := os.OpenFile(w.segmentName(seq), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.file = f
+	w.torn = false
+	w.segments = append(w.segments, seq)
+	w.sizes[seq] = 0
+	if len(w.segments) == 1 {
+		w.readSeq, w.readOff = seq, 0
+	}
+	return nil
+}
+
+// discard truncates the current segment to its size before a
+// failed write, e.g. if the disk is full. If the partial record
+// cannot be removed, the next write starts a new segment, the
+// partial record at the end of the segment is skipped by the
+// reader.
+func (w *SpoolWriter) discard(size int64) {
+	err := w.file.Truncate(size)
+	if err == nil {
+		_, err = w.file.Seek(size, io.SeekStart)
+	}
+	w.torn = err != nil
+}
+
+// evict deletes the oldest segments while the disk budget
+// is exceeded. The dropped bytes are reported by the
+// background goroutine, Write is called by the router
+// with its lock held.
+func (w *SpoolWriter) evict() {
+	for w.total > w.config.MaxBytes && len(w.segments) > 1 {
+		seq := w.segments[0]
+		w.dropped += w.sizes[seq]
+		if seq == w.readSeq {
+			w.dropped -= w.readOff
+		}
+		w.remove(seq)
+	}
+	if w.dropped > 0 {
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// remove deletes the oldest segment.
+func (w *SpoolWriter) remove(seq uint64) {
+	os.Remove(w.segmentName(seq))
+	w.total -= w.sizes[seq]
+	delete(w.sizes, seq)
+	w.segments = w.segments[1:]
+	if seq == w.readSeq {
+		w.readSeq, w.readOff = w.segments[0], 0
+		w.saveCursor()
+	}
+}
+
+func (w *SpoolWriter) segmentName(seq uint64) string {
+	return filepath.Join(w.config.Dir, fmt.Sprintf("%020d%s", seq, spoolExt))
+}
+
+// saveCursor persists the position of the next
+// log message to be delivered.
+func (w *SpoolWriter) saveCursor() error {
+	name := filepath.Join(w.config.Dir, spoolCursor)
+	err := os.WriteFile(name+".tmp", []byte(fmt.Sprintf("%d %d\n", w.readSeq, w.readOff)), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+// loop delivers the log messages to the destination.
+func (w *SpoolWriter) loop() {
+	defer w.wg.Done()
+
+	var f *os.File
+	var fseq uint64
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	failing := false
+	delivered := 0
+	for {
+		w.mu.Lock()
+		seq, off := w.readSeq, w.readOff
+		size := w.sizes[seq]
+		last := seq == w.segments[len(w.segments)-1]
+		if off >= size {
+			if !last {
+				// the segment has been delivered
+				w.remove(seq)
+				w.mu.Unlock()
+				continue
+			}
+			if delivered > 0 {
+				w.saveCursor()
+				delivered = 0
+			}
+		}
+		report := w.report
+		dropped := w.dropped
+		w.dropped = 0
+		w.mu.Unlock()
+
+		if dropped > 0 && report != nil {
+			report(fmt.Errorf("log: spool: disk budget exceeded, %d bytes of undelivered log messages dropped", dropped))
+		}
+
+		if off >= size {
+			select {
+			case <-w.notify:
+				continue
+			case <-w.done:
+				return
+			}
+		}
+
+		if f == nil || fseq != seq {
+			if f != nil {
+				f.Close()
+			}
+			var err error
+			f, err = os.Open(w.segmentName(seq))
+			if err != nil {
+				// evicted meanwhile
+				f = nil
+				continue
+			}
+			fseq = seq
+		}
+
+		b, err := readSpoolRecord(f, off, size)
+		if err != nil {
+			// truncated by a crash, skip the rest of the segment
+			w.advance(seq, off, size)
+			continue
+		}
+
+		_, err = w.config.Writer.Write(b)
+		if err != nil {
+			if !failing && report != nil {
+				report(err)
+			}
+			failing = true
+
+			select {
+			case <-time.After(w.config.RetryInterval):
+				continue
+			case <-w.done:
+				return
+			}
+		}
+		failing = false
+
+		w.advance(seq, off, off+4+int64(len(b)))
+		delivered++
+		if delivered >= 100 {
+			w.mu.Lock()
+			w.saveCursor()
+			w.mu.Unlock()
+			delivered = 0
+		}
+	}
+}
+
+// advance moves the read position from off to next
+// unless the segment has been evicted meanwhile.
+func (w *SpoolWriter) advance(seq uint64, off, next int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.readSeq == seq && w.readOff == off {
+		w.readOff = next
+	}
+}
+
+func readSpoolRecord(f *os.File, off, size int64) ([]byte, error) {
+	if off+4 > size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	var h [4]byte
+	_, err := f.ReadAt(h[:], off)
+	if err != nil {
+		return nil, err
+	}
+
+	n := int64(binary.BigEndian.Uint32(h[:]))
+	if off+4+n > size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := make([]byte, n)
+	_, err = f.ReadAt(b, off+4)
+	return b, err
+}
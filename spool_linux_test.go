@@ -0,0 +1,67 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"github.com/szxp/log"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestSpoolWriterPartialWrite(t *testing.T) {
+	dir := os.Getenv("LOG_TEST_SPOOL_DIR")
+	if dir == "" {
+		// the file size limit is set in a new process
+		cmd := exec.Command(os.Args[0], "-test.run=^TestSpoolWriterPartialWrite$")
+		cmd.Env = append(os.Environ(), "LOG_TEST_SPOOL_DIR="+t.TempDir())
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("non-nil error: %v\n%s", err, out)
+		}
+		return
+	}
+
+	w, err := log.SpoolConfig{Dir: dir, Writer: &flakyWriter{fail: true}}.NewWriter()
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+
+	// a record is 13 bytes, the third one is written partially
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_FSIZE, &limit); err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	if err := syscall.Setrlimit(syscall.RLIMIT_FSIZE, &syscall.Rlimit{Cur: 30, Max: limit.Max}); err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	w.Write([]byte("message0\n"))
+	w.Write([]byte("message1\n"))
+	_, err = w.Write([]byte("message2\n"))
+	if err := syscall.Setrlimit(syscall.RLIMIT_FSIZE, &limit); err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	w.Write([]byte("message3\n"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+
+	up := &flakyWriter{}
+	w, err = log.SpoolConfig{Dir: dir, Writer: up}.NewWriter()
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	defer w.Close()
+
+	expected := "message0\nmessage1\nmessage3\n"
+	if actual := strings.Join(up.wait(t, 3), ""); actual != expected {
+		t.Fatalf("expected %q, but got %q", expected, actual)
+	}
+}
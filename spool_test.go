@@ -0,0 +1,169 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/szxp/log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// goroutine safe
+type flakyWriter struct {
+	mu    sync.Mutex
+	fail  bool
+	lines []string
+}
+
+func (w *flakyWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fail {
+		return 0, errors.New("destination down")
+	}
+	w.lines = append(w.lines, string(b))
+	return len(b), nil
+}
+
+func (w *flakyWriter) setFail(fail bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.fail = fail
+}
+
+// wait waits until n lines are written and returns them.
+func (w *flakyWriter) wait(t *testing.T, n int) []string {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		w.mu.Lock()
+		if len(w.lines) >= n {
+			lines := append([]string(nil), w.lines...)
+			w.mu.Unlock()
+			return lines
+		}
+		w.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %d lines", n)
+	return nil
+}
+
+func TestSpoolWriter(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	dest := &flakyWriter{fail: true}
+
+	w, err := log.SpoolConfig{
+		Dir:           dir,
+		Writer:        dest,
+		SegmentBytes:  20,
+		RetryInterval: time.Millisecond,
+	}.NewWriter()
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+
+	var expected []string
+	for i := 0; i < 10; i++ {
+		line := fmt.Sprintf("message%d\n", i)
+		expected = append(expected, line)
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+	}
+
+	// messages are kept while the destination is down
+	time.Sleep(20 * time.Millisecond)
+	dest.setFail(false)
+
+	actual := strings.Join(dest.wait(t, 10), "")
+	if actual != strings.Join(expected, "") {
+		t.Fatalf("expected %q, but got %q", strings.Join(expected, ""), actual)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+}
+
+func TestSpoolWriterRestart(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	down := &flakyWriter{fail: true}
+
+	w, err := log.SpoolConfig{Dir: dir, Writer: down, SegmentBytes: 20}.NewWriter()
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		w.Write([]byte(fmt.Sprintf("message%d\n", i)))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+
+	up := &flakyWriter{}
+	w, err = log.SpoolConfig{Dir: dir, Writer: up, SegmentBytes: 20}.NewWriter()
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	w.Write([]byte("message5\n"))
+
+	expected := "message0\nmessage1\nmessage2\nmessage3\nmessage4\nmessage5\n"
+	if actual := strings.Join(up.wait(t, 6), ""); actual != expected {
+		t.Fatalf("expected %q, but got %q", expected, actual)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+
+	// delivered messages are not replayed
+	again := &flakyWriter{}
+	w, err = log.SpoolConfig{Dir: dir, Writer: again}.NewWriter()
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	w.Write([]byte("message6\n"))
+	if actual := strings.Join(again.wait(t, 1), ""); actual != "message6\n" {
+		t.Fatalf("expected %q, but got %q", "message6\n", actual)
+	}
+	w.Close()
+}
+
+func TestSpoolWriterMaxBytes(t *testing.T) {
+	t.Parallel()
+
+	dest := &flakyWriter{fail: true}
+	w, err := log.SpoolConfig{
+		Dir:           t.TempDir(),
+		Writer:        dest,
+		SegmentBytes:  13, // a message per segment
+		MaxBytes:      40,
+		RetryInterval: time.Millisecond,
+	}.NewWriter()
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 10; i++ {
+		w.Write([]byte(fmt.Sprintf("message%d\n", i)))
+	}
+	dest.setFail(false)
+
+	// the oldest messages are evicted
+	lines := dest.wait(t, 3)
+	time.Sleep(20 * time.Millisecond)
+	lines = dest.wait(t, 3)
+	expected := "message7\nmessage8\nmessage9\n"
+	if actual := strings.Join(lines, ""); actual != expected {
+		t.Fatalf("expected %q, but got %q", expected, actual)
+	}
+}
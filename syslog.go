@@ -0,0 +1,405 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Syslog facilities, see RFC 5424.
+const (
+	FacilityKern = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+)
+
+// Local use syslog facilities, see RFC 5424.
+const (
+	FacilityLocal0 = iota + 16
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// DefaultSDID is the SD-ID of the structured data element
+// the fields are written to by the SyslogFormatter.
+const DefaultSDID = "fields@32473"
+
+// syslogTimeLayout is RFC 3339 with at most 6 fractional
+// digits, as TIME-SECFRAC is limited in RFC 5424.
+const syslogTimeLayout = "2006-01-02T15:04:05.999999Z07:00"
+
+// SyslogFormatter converts a log message into a syslog message
+// as defined by RFC 5424, or by RFC 3164 if requested.
+//
+// The value at the key FieldLevel is mapped to the syslog
+// severity, the value at the key FieldLogger is used as APP-NAME
+// and the value at the key FieldMessage is used as MSG. The rest
+// of the fields are written to a single STRUCTURED-DATA element,
+// nested Fields are flattened with dot-separated names. Keys that
+// begin with underscore will be skipped.
+//
+// RFC 3164 has no structured data, the rest of the fields are
+// appended to the MSG as a JSON encoded string.
+//
+// SyslogFormatter is safe for concurrent use by multiple goroutines.
+type SyslogFormatter struct {
+	// Facility of the messages. If zero, FacilityUser will be used.
+	Facility int
+
+	// Hostname of the messages. If empty, the hostname
+	// reported by the kernel will be used.
+	Hostname string
+
+	// AppName of the messages. If empty, the value at the
+	// key FieldLogger will be used.
+	AppName string
+
+	// MsgID of the messages. It is optional.
+	MsgID string
+
+	// SDID is the SD-ID of the structured data element.
+	// If empty, DefaultSDID will be used.
+	SDID string
+
+	// RFC3164 selects the legacy BSD syslog format.
+	RFC3164 bool
+
+	// TimeEncoding specifies how the times and durations
+	// of the structured data are encoded.
+	TimeEncoding TimeEncoding
+}
+
+// Format returns the fields as a syslog message.
+func (f *SyslogFormatter) Format(fields Fields) ([]byte, error) {
+	facility := f.Facility
+	if facility == 0 {
+		facility = FacilityUser
+	}
+	pri := facility*8 + severity(fields[FieldLevel])
+
+	hostname := f.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	appName := f.AppName
+	if appName == "" {
+		appName, _ = fields[FieldLogger].(string)
+	}
+
+	msg := ""
+	if v, ok := fields[FieldMessage]; ok {
+		msg = fmt.Sprint(resolve(v))
+	}
+
+	t := timestamp(fields)
+	fields = f.TimeEncoding.Fields(fields)
+	pid := strconv.Itoa(os.Getpid())
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("<" + strconv.Itoa(pri) + ">")
+
+	if f.RFC3164 {
+		buf.WriteString(t.Format(time.Stamp))
+		buf.WriteByte(' ')
+		buf.WriteString(headerField(hostname, 255))
+		buf.WriteByte(' ')
+		if appName != "" {
+			buf.WriteString(headerField(appName, 32))
+		} else {
+			buf.WriteString(headerField(filepath.Base(os.Args[0]), 32))
+		}
+		buf.WriteString("[" + pid + "]: ")
+		buf.WriteString(msg)
+
+		rest := Fields{FieldSort: true}
+		for k, v := range fields {
+			if !syslogHeaderField(k) {
+				rest[k] = v
+			}
+		}
+		if len(rest) > 1 {
+			b, err := json.Marshal(rest)
+			if err != nil {
+				return nil, err
+			}
+			if msg != "" {
+				buf.WriteByte(' ')
+			}
+			buf.Write(b)
+		}
+		return buf.Bytes(), nil
+	}
+
+	sdid := f.SDID
+	if sdid == "" {
+		sdid = DefaultSDID
+	}
+
+	buf.WriteString("1 ")
+	buf.WriteString(t.Format(syslogTimeLayout))
+	buf.WriteByte(' ')
+	buf.WriteString(headerField(hostname, 255))
+	buf.WriteByte(' ')
+	buf.WriteString(headerField(appName, 48))
+	buf.WriteByte(' ')
+	buf.WriteString(headerField(pid, 128))
+	buf.WriteByte(' ')
+	buf.WriteString(headerField(f.MsgID, 32))
+	buf.WriteByte(' ')
+
+	params := make([]sdParam, 0, len(fields))
+	err := appendSDParams(&params, "", fields, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(params) == 0 {
+		buf.WriteByte('-')
+	} else {
+		sort.Sort(sdParams(params))
+		buf.WriteByte('[')
+		buf.WriteString(sdName(sdid))
+		for _, p := range params {
+			buf.WriteByte(' ')
+			buf.WriteString(p.name)
+			buf.WriteString(`="`)
+			buf.WriteString(sdValueEscaper.Replace(p.value))
+			buf.WriteByte('"')
+		}
+		buf.WriteByte(']')
+	}
+
+	if msg != "" {
+		buf.WriteByte(' ')
+		buf.WriteString(msg)
+	}
+	return buf.Bytes(), nil
+}
+
+// syslogHeaderField reports whether the value at the given
+// top-level key is written to the header of the syslog message
+// or must be skipped otherwise.
+func syslogHeaderField(k string) bool {
+	switch k {
+	case FieldLevel, FieldLogger, FieldMessage, FieldTime:
+		return true
+	}
+	return len(k) == 0 || k[0] == '_'
+}
+
+type sdParam struct {
+	name  string
+	value string
+}
+
+type sdParams []sdParam
+
+func (p sdParams) Len() int           { return len(p) }
+func (p sdParams) Less(i, j int) bool { return p[i].name < p[j].name }
+func (p sdParams) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+func appendSDParams(params *[]sdParam, prefix string, fields Fields, top bool) error {
+	for k, v := range fields {
+		if top && syslogHeaderField(k) {
+			continue
+		}
+		if len(k) > 0 && k[0] == '_' {
+			continue
+		}
+
+		name := prefix + k
+		v = resolve(v)
+		if fv, ok := v.(Fields); ok {
+			err := appendSDParams(params, name+".", fv, false)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		var value string
+		switch v := v.(type) {
+		case string:
+			value = v
+		case nil:
+			value = ""
+		case bool, int, int8, int16, int32, int64, uint, uint8, uint16,
+			uint32, uint64, float32, float64:
+			value = fmt.Sprint(v)
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			value = string(b)
+		}
+		*params = append(*params, sdParam{sdName(name), value})
+	}
+	return nil
+}
+
+// sdName returns a valid SD-NAME, invalid characters
+// are replaced with underscore.
+func sdName(s string) string {
+	b := []byte(s)
+	if len(b) > 32 {
+		b = b[:32]
+	}
+	for i, c := range b {
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
+
+var sdValueEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// headerField returns a valid syslog header field with at
+// most max characters. Non printable characters are replaced
+// with underscore, an empty field is replaced with NILVALUE.
+func headerField(s string, max int) string {
+	if s == "" {
+		return "-"
+	}
+	b := []byte(s)
+	if len(b) > max {
+		b = b[:max]
+	}
+	for i, c := range b {
+		if c < 33 || c > 126 {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// SyslogWriter writes log messages to a syslog daemon.
+//
+// The connection is established on the first write and
+// reestablished if a write fails. On datagram networks
+// the trailing newline appended by the router is removed,
+// every log message is sent in its own datagram. On stream
+// networks messages are separated by newlines.
+//
+// SyslogWriter is safe for concurrent use by multiple goroutines.
+type SyslogWriter struct {
+	// Network is the network of the syslog daemon,
+	// e.g. "unixgram", "unix", "udp" or "tcp".
+	//
+	// If both the Network and the Address are empty,
+	// the local syslog daemon will be used at one of
+	// the well-known unix socket paths such as "/dev/log".
+	Network string
+
+	// Address is the address of the syslog daemon.
+	// If empty on unix networks, the well-known unix
+	// socket paths will be tried.
+	Address string
+
+	mu      sync.Mutex
+	conn    net.Conn
+	network string
+}
+
+var syslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// Write writes the log message to the syslog daemon.
+func (w *SyslogWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			w.conn, w.network, err = w.dial()
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		msg := b
+		if isDatagram(w.network) {
+			msg = bytes.TrimSuffix(b, []byte{'\n'})
+		}
+		if _, err = w.conn.Write(msg); err == nil {
+			return len(b), nil
+		}
+
+		w.conn.Close()
+		w.conn = nil
+	}
+	return 0, err
+}
+
+// Close closes the connection to the syslog daemon.
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *SyslogWriter) dial() (net.Conn, string, error) {
+	if w.Address != "" {
+		conn, err := net.Dial(w.Network, w.Address)
+		return conn, w.Network, err
+	}
+
+	networks := []string{"unixgram", "unix"}
+	if w.Network != "" {
+		networks = []string{w.Network}
+	}
+	for _, network := range networks {
+		for _, path := range syslogPaths {
+			conn, err := net.Dial(network, path)
+			if err == nil {
+				return conn, network, nil
+			}
+		}
+	}
+	return nil, "", errors.New("log: unix syslog daemon not found")
+}
+
+func isDatagram(network string) bool {
+	switch network {
+	case "unixgram", "udp", "udp4", "udp6":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"github.com/szxp/log"
+	"net"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSyslogFormatter(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		formatter *log.SyslogFormatter
+		fields    log.Fields
+		expected  string
+	}{
+		{"empty", &log.SyslogFormatter{Hostname: "host1"}, log.Fields{"time": "2017-03-04T10:20:30Z"},
+			`^<14>1 2017-03-04T10:20:30Z host1 - [0-9]+ - -$`},
+		{"header", &log.SyslogFormatter{Hostname: "host1", MsgID: "ID47"},
+			log.Fields{"time": "2017-03-04T10:20:30Z", "level": "error", "logger": "app1", "msg": "failed"},
+			`^<11>1 2017-03-04T10:20:30Z host1 app1 [0-9]+ ID47 - failed$`},
+		{"microseconds", &log.SyslogFormatter{Hostname: "host1"},
+			log.Fields{"time": time.Date(2020, 1, 1, 0, 0, 0, 123456789, time.UTC)},
+			`^<14>1 2020-01-01T00:00:00.123456Z host1 - [0-9]+ - -$`},
+		{"facility", &log.SyslogFormatter{Hostname: "host1", Facility: log.FacilityLocal4},
+			log.Fields{"time": "2017-03-04T10:20:30Z", "level": "debug"},
+			`^<167>1 2017-03-04T10:20:30Z host1 - [0-9]+ - -$`},
+		{"structured data", &log.SyslogFormatter{Hostname: "host1", AppName: "app2"},
+			log.Fields{"time": "2017-03-04T10:20:30Z", "logger": "app1", "msg": "hello",
+				"user": log.Fields{"id": 1, "name": `a"b]c\`}, "tags": []string{"x"}, "_skip": 1},
+			`^<14>1 2017-03-04T10:20:30Z host1 app2 [0-9]+ - \[fields@32473 tags="\[\\"x\\"\\\]" user.id="1" user.name="a\\"b\\\]c\\\\"\] hello$`},
+		{"rfc3164", &log.SyslogFormatter{Hostname: "host1", RFC3164: true},
+			log.Fields{"time": "2017-03-04T10:20:30Z", "level": "warn", "logger": "app1", "msg": "hello", "user": "admin"},
+			`^<12>Mar  4 10:20:30 host1 app1\[[0-9]+\]: hello {"user":"admin"}$`},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			b, err := tc.formatter.Format(tc.fields)
+			if err != nil {
+				t.Fatalf("non-nil error: %v", err)
+			}
+
+			re := regexp.MustCompile(tc.expected)
+			if !re.Match(b) {
+				t.Fatalf("expected %v, but got: %q", re.String(), string(b))
+			}
+		})
+	}
+}
+
+func TestSyslogWriter(t *testing.T) {
+	t.Parallel()
+
+	addr := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	defer conn.Close()
+
+	w := &log.SyslogWriter{Network: "unixgram", Address: addr}
+	defer w.Close()
+
+	for _, msg := range []string{"<14>1 message1\n", "<14>1 message2\n"} {
+		if _, err := w.Write([]byte(msg)); err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+
+		buf := make([]byte, 1024)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("non-nil error: %v", err)
+		}
+		if expected := msg[:len(msg)-1]; string(buf[:n]) != expected {
+			t.Fatalf("expected %q, but got: %q", expected, string(buf[:n]))
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log
+
+import (
+	"time"
+)
+
+// Layouts of TimeEncoding that encode time.Time values
+// as the number of seconds, milliseconds or nanoseconds
+// elapsed since the Unix epoch, rather than as a string.
+const (
+	TimeUnix      = "unix"
+	TimeUnixMilli = "unixmilli"
+	TimeUnixNano  = "unixnano"
+)
+
+// Encodings of time.Duration values of TimeEncoding.
+const (
+	// DurationNanos encodes a duration as an int64
+	// number of nanoseconds, e.g. 1500000000.
+	DurationNanos = iota
+
+	// DurationString encodes a duration as a string,
+	// e.g. "1.5s", see time.Duration.String.
+	DurationString
+
+	// DurationSeconds encodes a duration as a float64
+	// number of seconds, e.g. 1.5.
+	DurationSeconds
+)
+
+// TimeEncoding specifies how a formatter encodes the time.Time
+// and time.Duration values of a log message, including the
+// time added by the Logger at the key FieldTime.
+//
+// The zero value encodes times as RFC 3339 strings with
+// nanoseconds and durations as int64 nanoseconds, the same
+// as encoding/json does.
+type TimeEncoding struct {
+	// Layout of the times. It is either a layout of the
+	// standard time package, e.g. time.RFC3339, or one of
+	// TimeUnix, TimeUnixMilli and TimeUnixNano. If empty,
+	// time.RFC3339Nano will be used.
+	Layout string
+
+	// Duration is the encoding of the durations,
+	// DurationNanos, DurationString or DurationSeconds.
+	Duration int
+}
+
+// Fields returns a copy of the fields in which the time.Time
+// and time.Duration values are replaced with their encoded
+// values, nested Fields and slices are copied as well. If the
+// encoding is the zero value, the fields are returned unchanged.
+func (e TimeEncoding) Fields(fields Fields) Fields {
+	if e == (TimeEncoding{}) {
+		return fields
+	}
+	return e.fields(fields)
+}
+
+func (e TimeEncoding) fields(fields Fields) Fields {
+	return transform(fields, nil, e.value).(Fields)
+}
+
+// Value returns the encoded value of a time.Time or a
+// time.Duration. Other values are returned unchanged.
+func (e TimeEncoding) Value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Time:
+		switch e.Layout {
+		case TimeUnix:
+			return v.Unix()
+		case TimeUnixMilli:
+			return v.UnixNano() / int64(time.Millisecond)
+		case TimeUnixNano:
+			return v.UnixNano()
+		case "":
+			return v.Format(time.RFC3339Nano)
+		}
+		return v.Format(e.Layout)
+	case time.Duration:
+		switch e.Duration {
+		case DurationString:
+			return v.String()
+		case DurationSeconds:
+			return v.Seconds()
+		}
+		return int64(v)
+	}
+	return v
+}
+
+// value resolves and encodes an element of a container,
+// the elements of the resolved containers are encoded as well.
+func (e TimeEncoding) value(v interface{}, path []string) (interface{}, bool) {
+	return e.Value(resolve(v)), true
+}
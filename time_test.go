@@ -0,0 +1,151 @@
+// Copyright 2017 Szakszon Péter. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package log_test
+
+import (
+	"github.com/szxp/log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggerTime(t *testing.T) {
+	t.Parallel()
+
+	spy := &routerSpy{}
+	before := time.Now()
+	log.LoggerConfig{Time: true, UTC: true, Router: spy}.NewLogger().Log(nil)
+
+	v, ok := spy.fields[log.FieldTime].(time.Time)
+	if !ok {
+		t.Fatalf("expected a time.Time, but got %T", spy.fields[log.FieldTime])
+	}
+	if v.Location() != time.UTC {
+		t.Fatalf("expected %v, but got %v", time.UTC, v.Location())
+	}
+	if v.Before(before) || v.After(time.Now()) {
+		t.Fatalf("unexpected time: %v", v)
+	}
+
+	match, err := log.Not(log.Eq(log.FieldTime, time.Time{})).Match(spy.fields)
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	if !match {
+		t.Fatalf("expected a match")
+	}
+}
+
+func TestTimeEncoding(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2017, 3, 4, 5, 6, 7, 8009000, time.UTC)
+	fields := log.Fields{
+		"time":    ts,
+		"elapsed": 1500 * time.Millisecond,
+		"retries": []interface{}{log.Fields{"after": time.Second}},
+		"lazy":    log.Lazy(func() interface{} { return ts }),
+		"_sort":   true,
+	}
+
+	testCases := []struct {
+		testName string
+		encoding log.TimeEncoding
+		expected string
+	}{
+		{"zero", log.TimeEncoding{},
+			`{"elapsed":1500000000,"lazy":"2017-03-04T05:06:07.008009Z","retries":[{"after":1000000000}],"time":"2017-03-04T05:06:07.008009Z"}`},
+		{"layout", log.TimeEncoding{Layout: time.RFC1123, Duration: log.DurationString},
+			`{"elapsed":"1.5s","lazy":"Sat, 04 Mar 2017 05:06:07 UTC","retries":[{"after":"1s"}],"time":"Sat, 04 Mar 2017 05:06:07 UTC"}`},
+		{"unix", log.TimeEncoding{Layout: log.TimeUnix, Duration: log.DurationSeconds},
+			`{"elapsed":1.5,"lazy":1488603967,"retries":[{"after":1}],"time":1488603967}`},
+		{"unix milli", log.TimeEncoding{Layout: log.TimeUnixMilli, Duration: log.DurationNanos},
+			`{"elapsed":1500000000,"lazy":1488603967008,"retries":[{"after":1000000000}],"time":1488603967008}`},
+		{"unix nano", log.TimeEncoding{Layout: log.TimeUnixNano},
+			`{"elapsed":1500000000,"lazy":1488603967008009000,"retries":[{"after":1000000000}],"time":1488603967008009000}`},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.testName, func(t *testing.T) {
+			t.Parallel()
+			f := &log.JSONFormatter{TimeEncoding: tc.encoding}
+			b, err := f.Format(fields)
+			if err != nil {
+				t.Fatalf("non-nil error: %v", err)
+			}
+			if string(b) != tc.expected {
+				t.Fatalf("expected %q, but got %q", tc.expected, string(b))
+			}
+		})
+	}
+
+	if _, ok := fields["time"].(time.Time); !ok {
+		t.Fatalf("the fields have been modified")
+	}
+}
+
+func TestTimeEncodingNested(t *testing.T) {
+	t.Parallel()
+
+	fields := log.Fields{
+		"map": map[string]interface{}{
+			"after": time.Second,
+			"list":  []log.Fields{{"after": 2 * time.Second}},
+		},
+		"durations": []time.Duration{3 * time.Second},
+		"_sort":     true,
+	}
+
+	f := &log.JSONFormatter{TimeEncoding: log.TimeEncoding{Duration: log.DurationString}}
+	b, err := f.Format(fields)
+	if err != nil {
+		t.Fatalf("non-nil error: %v", err)
+	}
+	expected := `{"durations":["3s"],"map":{"after":"1s","list":[{"after":"2s"}]}}`
+	if string(b) != expected {
+		t.Fatalf("expected %q, but got %q", expected, string(b))
+	}
+	if _, ok := fields["map"].(map[string]interface{})["after"].(time.Duration); !ok {
+		t.Fatalf("the fields have been modified")
+	}
+}
+
+func TestTimeEncodingFormatters(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	fields := log.Fields{"time": ts, "msg": "done", "took": 2 * time.Second}
+	encoding := log.TimeEncoding{Layout: log.TimeUnix, Duration: log.DurationString}
+
+	testCases := []struct {
+		testName  string
+		formatter log.Formatter
+		expected  []string
+	}{
+		{"syslog", &log.SyslogFormatter{Hostname: "h", TimeEncoding: encoding},
+			[]string{"1 2017-03-04T05:06:07Z h", `took="2s"`}},
+		{"gelf", &log.GELFFormatter{Host: "h", TimeEncoding: encoding},
+			[]string{`"timestamp":1488603967`, `"_took":"2s"`}},
+		{"journal", &log.JournalFormatter{TimeEncoding: encoding},
+			[]string{"TIME=1488603967\n", "TOOK=2s\n"}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.testName, func(t *testing.T) {
+			t.Parallel()
+			b, err := tc.formatter.Format(fields)
+			if err != nil {
+				t.Fatalf("non-nil error: %v", err)
+			}
+			for _, s := range tc.expected {
+				if !strings.Contains(string(b), s) {
+					t.Fatalf("expected %q in %q", s, string(b))
+				}
+			}
+		})
+	}
+}